@@ -1,13 +1,17 @@
 module github.com/Liquid-Labs/catalyst-content-api
 
 require (
+	github.com/BurntSushi/toml v0.4.1
 	github.com/Liquid-Labs/catalyst-content-model v1.0.0-prototype.2
 	github.com/Liquid-Labs/catalyst-core-api v1.0.0-prototype.15
 	github.com/Liquid-Labs/go-api v1.0.0-protottype.0
 	github.com/Liquid-Labs/go-nullable-mysql v1.0.2
 	github.com/Liquid-Labs/go-rest v1.0.0-prototype.4
 	github.com/gorilla/mux v1.7.1
+	github.com/microcosm-cc/bluemonday v1.0.27
 	github.com/xanzy/go-gitlab v0.17.0
+	github.com/yuin/goldmark v1.4.13
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 // replace github.com/Liquid-Labs/go-rest => /Users/zane/playground/go-rest
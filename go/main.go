@@ -1,7 +1,10 @@
 package main
 
 import (
+  "context"
   "log"
+  "os"
+  "time"
 
   "github.com/Liquid-Labs/catalyst-core-api/go/restserv"
   // core resources
@@ -19,8 +22,64 @@ func main() {
   // our DB
   sqldb.RegisterSetup(content.SetupDB)
   sqldb.InitDB()
+  // asset storage
+  if blobDir := os.Getenv("CONTENT_BLOB_DIR"); blobDir != "" {
+    if store, err := content.NewLocalBlobStore(blobDir); err != nil {
+      log.Fatalf("Could not initialize blob store: %v", err)
+    } else {
+      content.SetBlobStore(store)
+    }
+  }
+  // local authoring sources
+  content.LocalDirRoot = os.Getenv("CONTENT_LOCAL_DIR_ROOT")
+  // content source secrets; re-encrypt any not under the current key
+  if secretKeys := os.Getenv("CONTENT_SECRET_KEYS"); secretKeys != "" {
+    if err := content.SetSecretKeys(secretKeys); err != nil {
+      log.Fatalf("Could not initialize content source secret keys: %v", err)
+    }
+    if count, err := content.RewrapContentSourceSecrets(context.Background()); err != nil {
+      log.Printf("Could not re-encrypt content source secrets: %v", err)
+    } else if count > 0 {
+      log.Printf("Re-encrypted %d content source secrets.", count)
+    }
+  } else if encrypted, plain, err := content.CountContentSourceSecrets(context.Background()); err != nil {
+    log.Printf("Could not check for content source secrets: %v", err)
+  } else if encrypted > 0 {
+    log.Fatalf("CONTENT_SECRET_KEYS must be set to read the %d encrypted content source secrets.", encrypted)
+  } else {
+    // without a key, no secret can be saved
+    log.Printf("CONTENT_SECRET_KEYS is not set; content sources with secrets (such as 'apiToken') cannot be created or updated (%d plain text secrets stored).", plain)
+  }
+  // runs left 'RUNNING' by a prior process will never finish
+  if count, err := content.FailInterruptedSyncRuns(context.Background()); err != nil {
+    log.Printf("Could not close out interrupted sync runs: %v", err)
+  } else if count > 0 {
+    log.Printf("Marked %d interrupted sync runs as failed.", count)
+  }
+  // URL content may resolve to private addresses only in development
+  content.AllowPrivateURLs = os.Getenv("CONTENT_ALLOW_PRIVATE_URLS") == "true"
   // our API
   restserv.RegisterResource(content.InitAPI)
+  // scheduled sync
+  if interval := os.Getenv("CONTENT_SYNC_INTERVAL"); interval != "" {
+    startSyncScheduler(interval, os.Getenv("CONTENT_SYNC_JITTER"))
+  }
   restserv.Init()
   log.Print("Init done.")
 }
+
+func startSyncScheduler(intervalSpec string, jitterSpec string) {
+  interval, err := time.ParseDuration(intervalSpec)
+  if err != nil || interval <= 0 {
+    log.Fatalf("Invalid CONTENT_SYNC_INTERVAL '%s'.", intervalSpec)
+  }
+  var jitter time.Duration
+  if jitterSpec != "" {
+    if jitter, err = time.ParseDuration(jitterSpec); err != nil || jitter < 0 {
+      log.Fatalf("Invalid CONTENT_SYNC_JITTER '%s'.", jitterSpec)
+    }
+  }
+
+  content.NewSyncScheduler(interval, jitter).Start()
+  log.Printf("Content sync scheduled every %s (jitter %s).", interval, jitter)
+}
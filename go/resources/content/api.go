@@ -2,8 +2,12 @@ package content
 
 import (
   "fmt"
+  "io"
+  "log"
+  "mime"
   "net/http"
   "regexp"
+  "strconv"
 
   "github.com/gorilla/mux"
 
@@ -19,58 +23,222 @@ func pingHandler(w http.ResponseWriter, r *http.Request) {
 
 func createHandler(w http.ResponseWriter, r *http.Request) {
   contentSummary := &model.ContentSummary{}
-  if _, restErr := handlers.CheckAndExtract(w, r, contentSummary, `ContentSumamry`); restErr != nil {
+  authClient, restErr := handlers.CheckAndExtract(w, r, contentSummary, `ContentSumamry`)
+  if restErr != nil {
     return // response handled by CheckAndExtract
   }
+  ctx := WithRevisionAuthor(r.Context(), authClient.GetToken().UID)
 
   var data interface{}
-  var restErr rest.RestError
   switch contentSummary.Type.String {
   case `TEXT`: {
     content := &model.ContentTypeText{}
     if restErr = rest.ExtractJson(w, r, content, `ContentTypeText`); restErr != nil {
       return // response handled by CheckAndExtract
     } else {
-      data, restErr = CreateContentTypeText(content, r.Context())
+      data, restErr = CreateContentTypeText(content, ctx)
+    }
+  }
+  case `IMAGE`, `FILE`: {
+    // The asset data is uploaded separately; see assetUploadHandler.
+    content := &ContentTypeAsset{}
+    if restErr = rest.ExtractJson(w, r, content, `ContentTypeAsset`); restErr != nil {
+      return // response handled by ExtractJson
+    } else {
+      data, restErr = CreateContentTypeAsset(content, ctx)
     }
   }
   default:
     rest.HandleError(w, rest.BadRequestError(fmt.Sprintf(`Invalid content type: '%s'`, contentSummary.Type.String), nil))
+    return
   }
 
   handlers.ProcessGenericResults(w, r, data, restErr, `Creating Content.`)
 }
 
+// syncHandler syncs the content source identified by either the 'source'
+// (public ID) or 'namespace' query parameter.
 func syncHandler(w http.ResponseWriter, r *http.Request) {
+  if _, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  }
 
+  query := r.URL.Query()
+  sourceID, namespace := query.Get(`source`), query.Get(`namespace`)
+  var source *model.ContentSource
+  var restErr rest.RestError
+  if sourceID != `` && namespace != `` {
+    restErr = rest.BadRequestError(`Specify one of 'source' or 'namespace', not both.`, nil)
+  } else if sourceID != `` {
+    source, restErr = GetContentSource(sourceID, r.Context())
+  } else if namespace != `` {
+    source, restErr = GetContentSourceByName(namespace, r.Context())
+  } else {
+    restErr = rest.BadRequestError(`Required 'source' or 'namespace' parameter is missing.`, nil)
+  }
+  if restErr != nil {
+    rest.HandleError(w, restErr)
+    return
+  }
+
+  if query.Get(`dryRun`) == `true` {
+    plan, restErr := PlanContentSource(source, r.Context())
+    handlers.ProcessGenericResults(w, r, plan, restErr, `Content sync planned.`)
+    return
+  }
+
+  summary, restErr := SyncContentSource(source, r.Context())
+  handlers.ProcessGenericResults(w, r, summary, restErr, `Content synced.`)
 }
 
 func listHandler(w http.ResponseWriter, r *http.Request) {
+  if _, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  }
+  searchParams, restErr := extractContentSearchParams(r)
+  if restErr != nil {
+    rest.HandleError(w, restErr)
+    return
+  }
+
+  vars := mux.Vars(r)
+  // empty outside of a context
+  searchParams.ContextType = vars["contextType"]
+  searchParams.ContextID = vars["contextID"]
+
+  results, restErr := ListContent(searchParams, r.Context())
+  handlers.ProcessGenericResults(w, r, results, restErr, `List Content.`)
+}
+
+func contextAddHandler(w http.ResponseWriter, r *http.Request) {
+  if _, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  }
+  vars := mux.Vars(r)
+  restErr := AddContentToContext(vars["contextType"], vars["contextID"], vars["pubID"], r.Context())
+  handlers.ProcessGenericResults(w, r, nil, restErr, `Content added to context.`)
+}
+
+func contextRemoveHandler(w http.ResponseWriter, r *http.Request) {
+  if _, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  }
   vars := mux.Vars(r)
-  contextType := vars["contextType"]
+  restErr := RemoveContentFromContext(vars["contextType"], vars["contextID"], vars["pubID"], r.Context())
+  handlers.ProcessGenericResults(w, r, nil, restErr, `Content removed from context.`)
+}
+
+const defaultListLimit = 25
+const maxListLimit = 100
+
+// extractContentSearchParams reads the 'search', 'sort', 'page', 'limit',
+// 'namespace', and 'type' query parameters. 'page' is zero-based.
+func extractContentSearchParams(r *http.Request) (*ContentSearchParams, rest.RestError) {
+  query := r.URL.Query()
+  sp := &ContentSearchParams{
+    Search    : query.Get(`search`),
+    Sort      : query.Get(`sort`),
+    Page      : 0,
+    Limit     : defaultListLimit,
+    Namespace : query.Get(`namespace`),
+    Type      : query.Get(`type`),
+  }
+
+  if _, ok := ContentSorts[sp.Sort]; !ok {
+    return nil, rest.BadRequestError(fmt.Sprintf(`Invalid sort: '%s'.`, sp.Sort), nil)
+  }
+  if pageString := query.Get(`page`); pageString != `` {
+    if page, err := strconv.Atoi(pageString); err != nil || page < 0 {
+      return nil, rest.BadRequestError(fmt.Sprintf(`Invalid page: '%s'.`, pageString), err)
+    } else {
+      sp.Page = page
+    }
+  }
+  if limitString := query.Get(`limit`); limitString != `` {
+    if limit, err := strconv.Atoi(limitString); err != nil || limit < 1 || limit > maxListLimit {
+      return nil, rest.BadRequestError(fmt.Sprintf(`Invalid limit: '%s'; must be between 1 and %d.`, limitString, maxListLimit), err)
+    } else {
+      sp.Limit = limit
+    }
+  }
+
+  return sp, nil
+}
+
+func trashListHandler(w http.ResponseWriter, r *http.Request) {
+  if _, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  }
+  searchParams, restErr := extractContentSearchParams(r)
+  if restErr != nil {
+    rest.HandleError(w, restErr)
+    return
+  }
+  if searchParams.Namespace == `` {
+    rest.HandleError(w, rest.BadRequestError(`Required 'namespace' parameter is missing.`, nil))
+    return
+  }
+  searchParams.Deleted = true
 
-  if contextType == "" {
-    fmt.Fprint(w, "TODO: listing contents")
+  results, restErr := ListContent(searchParams, r.Context())
+  handlers.ProcessGenericResults(w, r, results, restErr, `List deleted content.`)
+}
+
+func deleteHandler(w http.ResponseWriter, r *http.Request) {
+  pubID := mux.Vars(r)["pubID"]
+  if r.URL.Query().Get(`purge`) == `true` {
+    if !requireAdmin(w, r) {
+      return // response handled by requireAdmin
+    }
+    restErr := PurgeContent(pubID, r.Context())
+    handlers.ProcessGenericResults(w, r, nil, restErr, `Content purged.`)
   } else {
-    contextType := vars["contextType"]
-    contextId := vars["contextId"]
-    // TODO: distribute 'join' defs as common includes to all resources in a
-    // given system; e.g., list is compiled at app.
-    // TODO: make internal REST call to get the 'JOIN' info for unknowns?
-    fmt.Fprintf(w, "TODO: in context %s/%s\n", contextType, contextId)
+    authClient, restErr := handlers.BasicAuthCheck(w, r)
+    if restErr != nil {
+      return // response handled by BasicAuthCheck
+    }
+    restErr = DeleteContent(pubID, WithRevisionAuthor(r.Context(), authClient.GetToken().UID))
+    handlers.ProcessGenericResults(w, r, nil, restErr, `Content deleted.`)
+  }
+}
+
+func restoreHandler(w http.ResponseWriter, r *http.Request) {
+  authClient, restErr := handlers.BasicAuthCheck(w, r)
+  if restErr != nil {
+    return // response handled by BasicAuthCheck
   }
+  pubID := mux.Vars(r)["pubID"]
+  if restErr := RestoreContent(pubID, WithRevisionAuthor(r.Context(), authClient.GetToken().UID)); restErr != nil {
+    rest.HandleError(w, restErr)
+    return
+  }
+  result, restErr := GetContentTypeText(pubID, r.Context())
+  handlers.ProcessGenericResults(w, r, result, restErr, `Content restored.`)
+}
+
+// requireAdmin verifies the request is authenticated and carries the 'admin'
+// claim. Returns false if the check fails, in which case the error response has
+// been handled.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+  authClient, restErr := handlers.BasicAuthCheck(w, r)
+  if restErr != nil {
+    return false // response handled by BasicAuthCheck
+  }
+  if !authClient.HasAllClaims(`admin`) {
+    rest.HandleError(w, rest.AuthorizationError(`Operation requires administrative privileges.`, nil))
+    return false
+  }
+  return true
 }
 
 func detailHandler(w http.ResponseWriter, r *http.Request) {
   if _, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
     return // response handled by BasicAuthCheck
   } else {
-    // TODO: support multiple types
     pubID := mux.Vars(r)["pubID"]
-    var err rest.RestError
-    var result *model.ContentTypeText
+    var ref *ContentRef
     if uuidRe.MatchString(pubID) {
-      result, err = GetContentTypeText(pubID, r.Context())
+      ref, restErr = GetContentRef(pubID, r.Context())
     } else {
       if namespace, ok := r.URL.Query()[`namespace`]; !ok || len(namespace) != 1 {
         var msg string
@@ -82,26 +250,166 @@ func detailHandler(w http.ResponseWriter, r *http.Request) {
         rest.HandleError(w, rest.BadRequestError(msg, nil))
         return
       } else {
-        result, err = GetContentTypeTextByNSSlug(namespace[0], pubID, r.Context())
+        ref, restErr = GetContentRefByNSSlug(namespace[0], pubID, r.Context())
       }
     }
-    handlers.ProcessGenericResults(w, r, result, err, `Retrieve Content.`)
+    if restErr != nil {
+      rest.HandleError(w, restErr)
+      return
+    }
+
+    render := r.URL.Query().Get(`render`)
+    if isAssetType(ref.Type) && render != `` {
+      rest.HandleError(w, rest.BadRequestError(fmt.Sprintf(`Cannot render '%s' content.`, ref.Type), nil))
+      return
+    } else if render != `` && render != `html` {
+      rest.HandleError(w, rest.BadRequestError(fmt.Sprintf(`Unsupported render: '%s'.`, render), nil))
+      return
+    }
+    // The ETag is retrieved first so that, should the content change in the
+    // meantime, it can only be older than the content returned.
+    if notModified, restErr := writeContentETag(w, r, ref.PubID); restErr != nil {
+      rest.HandleError(w, restErr)
+      return
+    } else if notModified {
+      return
+    }
+
+    switch {
+    case isAssetType(ref.Type):
+      result, err := GetContentTypeAsset(ref.PubID, r.Context())
+      handlers.ProcessGenericResults(w, r, result, err, `Retrieve Content.`)
+    case render == ``:
+      result, err := GetContentTypeText(ref.PubID, r.Context())
+      handlers.ProcessGenericResults(w, r, result, err, `Retrieve Content.`)
+    default: // render == `html`
+      var rendered *RenderedContentTypeText
+      result, err := GetContentTypeText(ref.PubID, r.Context())
+      if err == nil {
+        rendered, err = RenderContentTypeText(result)
+      }
+      handlers.ProcessGenericResults(w, r, rendered, err, `Retrieve Content.`)
+    }
+  }
+}
+
+// writeContentETag sets the content ETag header. If the request
+// 'If-None-Match' matches, responds with 304 Not Modified and returns true.
+func writeContentETag(w http.ResponseWriter, r *http.Request, pubID string) (bool, rest.RestError) {
+  etag, restErr := GetContentETag(pubID, r.Context())
+  if restErr != nil {
+    return false, restErr
+  }
+  w.Header().Set(`ETag`, etag)
+  if ifNoneMatch := r.Header.Get(`If-None-Match`); ifNoneMatch != `` && matchETag(ifNoneMatch, etag, true) {
+    w.WriteHeader(http.StatusNotModified)
+    return true, nil
+  }
+  return false, nil
+}
+
+func revisionListHandler(w http.ResponseWriter, r *http.Request) {
+  if _, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  }
+
+  revisions, restErr := ListContentRevisions(mux.Vars(r)["pubID"], r.Context())
+  handlers.ProcessGenericResults(w, r, revisions, restErr, `List content revisions.`)
+}
+
+func revisionDetailHandler(w http.ResponseWriter, r *http.Request) {
+  if _, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  }
+
+  vars := mux.Vars(r)
+  // the route pattern guarantees a valid number
+  revisionNumber, _ := strconv.ParseInt(vars["revision"], 10, 64)
+  revision, restErr := GetContentRevision(vars["pubID"], revisionNumber, r.Context())
+  handlers.ProcessGenericResults(w, r, revision, restErr, `Retrieve content revision.`)
+}
+
+// assetUploadHandler stores the request body as the asset data. The request
+// 'Content-Type' is recorded as the asset MIME type. Bodies over maxAssetSize
+// are rejected by StoreContentTypeAssetData.
+func assetUploadHandler(w http.ResponseWriter, r *http.Request) {
+  authClient, restErr := handlers.BasicAuthCheck(w, r)
+  if restErr != nil {
+    return // response handled by BasicAuthCheck
+  }
+  ctx := WithRevisionAuthor(r.Context(), authClient.GetToken().UID)
+  pubID := mux.Vars(r)["pubID"]
+  defer r.Body.Close()
+
+  result, restErr := StoreContentTypeAssetData(pubID, r.Header.Get(`Content-Type`), r.Body, ctx)
+  handlers.ProcessGenericResults(w, r, result, restErr, `Content data uploaded.`)
+}
+
+// assetDataHandler serves the asset data with the recorded MIME type. The
+// checksum serves as a strong ETag.
+func assetDataHandler(w http.ResponseWriter, r *http.Request) {
+  if _, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  }
+  pubID := mux.Vars(r)["pubID"]
+  asset, data, restErr := OpenContentTypeAssetData(pubID, r.Context())
+  if restErr != nil {
+    rest.HandleError(w, restErr)
+    return
+  }
+  defer data.Close()
+
+  etag := `"` + asset.Checksum.String + `"`
+  w.Header().Set(`ETag`, etag)
+  if ifNoneMatch := r.Header.Get(`If-None-Match`); ifNoneMatch != `` && matchETag(ifNoneMatch, etag, true) {
+    w.WriteHeader(http.StatusNotModified)
+    return
+  }
+  w.Header().Set(`Content-Type`, asset.MimeType.String)
+  w.Header().Set(`Content-Length`, strconv.FormatInt(asset.Size.Int64, 10))
+  w.Header().Set(`X-Content-Type-Options`, `nosniff`)
+  // Keeps any script in the data (e.g., an SVG uploaded as a file) from running
+  // should the browser render it.
+  w.Header().Set(`Content-Security-Policy`, `default-src 'none'; sandbox`)
+  if asset.Type.String == `FILE` {
+    filename := asset.Slug.String
+    if filename == `` {
+      filename = pubID
+    }
+    w.Header().Set(`Content-Disposition`, mime.FormatMediaType(`attachment`, map[string]string{ `filename`: filename }))
+  }
+  if _, err := io.Copy(w, data); err != nil {
+    log.Printf("Error writing data for content '%s': %v", pubID, err)
   }
 }
 
+// updateHandler honors the 'If-Match' header; if the stored content no longer
+// matches, the update is rejected with 412 Precondition Failed and the current
+// ETag. See RequireIfMatch.
 func updateHandler(w http.ResponseWriter, r *http.Request) {
   newContent := &model.ContentSummary{}
-  if _, restErr := handlers.CheckAndExtract(w, r, newContent, `ContentSummary`); restErr != nil {
+  if authClient, restErr := handlers.CheckAndExtract(w, r, newContent, `ContentSummary`); restErr != nil {
     return // response handled by CheckAndExtract
   } else {
+    ctx := WithRevisionAuthor(r.Context(), authClient.GetToken().UID)
     contentType := newContent.GetType()
     pubID := mux.Vars(r)["pubID"]
+    ifMatch := r.Header.Get(`If-Match`)
+    if ifMatch == `` {
+      if RequireIfMatch {
+        rest.HandleError(w, newStatusError(http.StatusPreconditionRequired, `Content updates require an 'If-Match' header.`, nil))
+        return
+      }
+      ifMatch = `*` // any current version
+    }
 
     var data interface{}
+    var etag string
+    var stale bool
     switch contentType.String {
     case `TEXT`: {
       ctt := &model.ContentTypeText{}
-      if restErr = rest.ExtractJson(w, r, data, `ContentTypeText`); restErr != nil {
+      if restErr = rest.ExtractJson(w, r, ctt, `ContentTypeText`); restErr != nil {
         return // already handled
       }
 
@@ -110,10 +418,36 @@ func updateHandler(w http.ResponseWriter, r *http.Request) {
         return
       }
 
-      data, restErr = UpdateContentTypeText(ctt, r.Context())
+      var result *model.ContentTypeText
+      result, etag, stale, restErr = UpdateContentTypeTextIfMatch(ctt, ifMatch, ctx)
+      data = result
+    }
+    case `IMAGE`, `FILE`: {
+      cta := &ContentTypeAsset{}
+      if restErr = rest.ExtractJson(w, r, cta, `ContentTypeAsset`); restErr != nil {
+        return // already handled
+      }
+
+      // run the URL-entity PubID match check if we can
+      if uuidRe.MatchString(pubID) && !handlers.CheckUpdateByPubID(w, pubID, cta) {
+        return
+      }
+
+      var result *ContentTypeAsset
+      result, etag, stale, restErr = UpdateContentTypeAssetIfMatch(cta, ifMatch, ctx)
+      data = result
     }
     default:
-      rest.HandleError(w, rest.BadRequestError(fmt.Sprintf(`Unknown content type: '%s'`, contentType), nil))
+      rest.HandleError(w, rest.BadRequestError(fmt.Sprintf(`Unknown content type: '%s'`, contentType.String), nil))
+      return
+    }
+
+    if etag != `` {
+      w.Header().Set(`ETag`, etag)
+    }
+    if stale {
+      rest.HandleError(w, newStatusError(http.StatusPreconditionFailed, fmt.Sprintf(`Content '%s' has been modified; reload and merge changes.`, pubID), nil))
+      return
     }
     handlers.ProcessGenericResults(w, r, data, restErr, `Content updated.`)
   }
@@ -129,6 +463,18 @@ func InitAPI(r *mux.Router) {
   r.HandleFunc("/content/sync/", syncHandler).Methods("POST")
   r.HandleFunc("/content/", listHandler).Methods("GET")
   r.HandleFunc("/{contextType:[a-z-]*[a-z]}/{contextID:" + uuidReString + "}/content/", listHandler).Methods("GET")
+  r.HandleFunc("/{contextType:[a-z-]*[a-z]}/{contextID:" + uuidReString + "}/content/{pubID:" + uuidReString + "}/", contextAddHandler).Methods("PUT")
+  r.HandleFunc("/{contextType:[a-z-]*[a-z]}/{contextID:" + uuidReString + "}/content/{pubID:" + uuidReString + "}/", contextRemoveHandler).Methods("DELETE")
+  r.HandleFunc("/content/trash/", trashListHandler).Methods("GET")
   r.HandleFunc("/content/{pubID:" + contentIDReString + "}/", detailHandler).Methods("GET")
   r.HandleFunc("/content/{pubID:" + contentIDReString + "}/", updateHandler).Methods("PUT")
+  r.HandleFunc("/content/{pubID:" + uuidReString + "}/", deleteHandler).Methods("DELETE")
+  r.HandleFunc("/content/{pubID:" + uuidReString + "}/restore/", restoreHandler).Methods("POST")
+  r.HandleFunc("/content/{pubID:" + uuidReString + "}/asset/", assetUploadHandler).Methods("PUT")
+  r.HandleFunc("/content/{pubID:" + uuidReString + "}/asset/", assetDataHandler).Methods("GET")
+  r.HandleFunc("/content/{pubID:" + uuidReString + "}/revisions/", revisionListHandler).Methods("GET")
+  r.HandleFunc("/content/{pubID:" + uuidReString + "}/revisions/{revision:[1-9][0-9]{0,9}}/", revisionDetailHandler).Methods("GET")
+
+  initSourceAPI(r)
+  initNamespaceAPI(r)
 }
@@ -0,0 +1,322 @@
+package content
+
+import (
+  "context"
+  "crypto/rand"
+  "crypto/sha256"
+  "database/sql"
+  "encoding/hex"
+  "errors"
+  "fmt"
+  "io"
+  "log"
+  "mime"
+  "net/http"
+  "strings"
+
+  "github.com/Liquid-Labs/go-api/sqldb"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/Liquid-Labs/go-rest/rest"
+
+  model "github.com/Liquid-Labs/catalyst-content-model/go/resources/content"
+)
+
+// ContentTypeAsset is binary ('IMAGE' or 'FILE') content. The bytes are held
+// in the BlobStore; the record tracks the MIME type, size, and SHA-256
+// checksum of the stored bytes. These are null until the data is uploaded.
+type ContentTypeAsset struct {
+  model.ContentSummary
+  MimeType nulls.String `json:"mimeType"`
+  Size     nulls.Int64  `json:"size"`
+  Checksum nulls.String `json:"checksum"`
+  // blobKey locates the data in the BlobStore; see assetBlobKey.
+  blobKey nulls.String
+}
+
+// maxAssetSize limits the size of asset data.
+const maxAssetSize = 32 << 20 // 32MiB
+
+// assetBlobKey determines the BlobStore key for the asset data. Assets
+// uploaded before blob keys were recorded are stored under the public ID.
+func assetBlobKey(pubID string, blobKey nulls.String) string {
+  if blobKey.IsValid() {
+    return blobKey.String
+  }
+  return pubID
+}
+
+// newAssetBlobKey generates a unique key for a new upload of the asset data.
+func newAssetBlobKey(pubID string) (string, error) {
+  suffix := make([]byte, 8)
+  if _, err := io.ReadFull(rand.Reader, suffix); err != nil {
+    return ``, err
+  }
+  return pubID + `-` + hex.EncodeToString(suffix), nil
+}
+
+// isAssetType indicates whether the content type is handled as a
+// ContentTypeAsset.
+func isAssetType(contentType string) bool {
+  return contentType == `IMAGE` || contentType == `FILE`
+}
+
+// ContentRef identifies a content item and its type.
+type ContentRef struct {
+  PubID string
+  Type  string
+}
+
+// GetContentRef resolves the type of the (non-deleted) content identified by
+// public ID.
+func GetContentRef(pubID string, ctx context.Context) (*ContentRef, rest.RestError) {
+  return getContentRefHelper(getContentRefStmt, ctx, pubID)
+}
+
+// GetContentRefByNSSlug resolves the public ID and type of the (non-deleted)
+// content identified by namespace and slug.
+func GetContentRefByNSSlug(namespace string, slug string, ctx context.Context) (*ContentRef, rest.RestError) {
+  return getContentRefHelper(getContentRefByNSSlugStmt, ctx, namespace, slug)
+}
+
+func getContentRefHelper(stmt *sql.Stmt, ctx context.Context, ids ...interface{}) (*ContentRef, rest.RestError) {
+  var ref ContentRef
+  if err := stmt.QueryRowContext(ctx, ids...).Scan(&ref.PubID, &ref.Type); err == sql.ErrNoRows {
+    return nil, rest.NotFoundError(fmt.Sprintf(`Content '%v' not found.`, ids), nil)
+  } else if err != nil {
+    return nil, rest.ServerError(fmt.Sprintf(`Problem resolving content '%v'.`, ids), err)
+  }
+  return &ref, nil
+}
+
+func CreateContentTypeAsset(c *ContentTypeAsset, ctx context.Context) (*ContentTypeAsset, rest.RestError) {
+  txn, err := sqldb.DB.Begin()
+  if err != nil {
+    return nil, rest.ServerError("Could not create content record. (txn error)", err)
+  }
+
+  newID, restErr := createContentSummaryInTxn(&c.ContentSummary, txn)
+  if restErr != nil {
+    return nil, restErr // already rolled back
+  }
+
+  if _, err := txn.Stmt(createContentTypeAssetStmt).ExecContext(ctx, newID); err != nil {
+    defer txn.Rollback()
+    return nil, rest.UnprocessableEntityError("Failure creating content.", err)
+  }
+
+  contribInsStmt := txn.Stmt(contributorInsertWithContentIDStmt)
+  for _, contrib := range c.Contributors {
+    if _, err := contribInsStmt.ExecContext(ctx, newID, contrib.Role, contrib.SummaryCreditOrder, contrib.PubId); err != nil {
+      defer txn.Rollback()
+      // TODO: can we tell more about why? We're assuming bad data here.
+      return nil, rest.UnprocessableEntityError("Error updating contributors. Possible bad data.", err)
+    }
+  }
+
+  newContent, restErr := getContentTypeAssetHelper(getContentTypeAssetByIDStmt, ctx, txn, newID)
+  if restErr != nil {
+    defer txn.Rollback()
+    return nil, restErr
+  }
+  if restErr := recordAssetRevisionInTxn(newContent, ctx, txn); restErr != nil {
+    return nil, restErr // already rolled back
+  }
+  if err := txn.Commit(); err != nil {
+    return nil, rest.ServerError("Could not create content record. (commit error)", err)
+  }
+
+  return newContent, nil
+}
+
+// GetContentTypeAsset retrieves a ContentTypeAsset from a public ID string
+// (UUID). Attempting to retrieve a non-existent or deleted item results in a
+// rest.NotFoundError.
+func GetContentTypeAsset(pubID string, ctx context.Context) (*ContentTypeAsset, rest.RestError) {
+  return getContentTypeAssetHelper(getContentTypeAssetStmt, ctx, nil, pubID)
+}
+
+func getContentTypeAssetHelper(stmt *sql.Stmt, ctx context.Context, txn *sql.Tx, id interface{}) (*ContentTypeAsset, rest.RestError) {
+  if txn != nil {
+    stmt = txn.Stmt(stmt)
+  }
+  rows, err := stmt.QueryContext(ctx, id)
+  if err != nil {
+    return nil, rest.ServerError("Error retrieving content.", err)
+  }
+  defer rows.Close()
+
+  var content *ContentTypeAsset
+  contributors := make(model.ContributorSummaries, 0)
+  for rows.Next() {
+    var c ContentTypeAsset
+    var p model.ContributorSummary
+    if err := rows.Scan(&c.PubId, &c.LastUpdated, &c.Title, &c.Summary, &c.Namespace, &c.SourceType, &c.Slug, &c.Type,
+        &c.MimeType, &c.Size, &c.Checksum, &c.blobKey,
+        /* limited person data */ &p.PubId, &p.DisplayName,
+        /* contrib specific data */ &p.Role, &p.SummaryCreditOrder); err != nil {
+      return nil, rest.ServerError(fmt.Sprintf("Problem getting data for content: '%v'", id), err)
+    }
+    content = &c
+    if p.PubId.IsValid() {
+      contributors = append(contributors, &p)
+    }
+  }
+  if content == nil {
+    return nil, rest.NotFoundError(fmt.Sprintf(`Content '%v' not found.`, id), nil)
+  }
+  content.Contributors = contributors
+
+  return content, nil
+}
+
+// UpdateContentTypeAsset updates the asset Title, Summary, and Slug. The asset
+// data is updated separately with StoreContentTypeAssetData.
+func UpdateContentTypeAsset(c *ContentTypeAsset, ctx context.Context) (*ContentTypeAsset, rest.RestError) {
+  // results in a rest.NotFoundError if there is nothing to update
+  result, _, _, restErr := UpdateContentTypeAssetIfMatch(c, `*`, ctx)
+  return result, restErr
+}
+
+// StoreContentTypeAssetData writes the asset bytes to the BlobStore and
+// records the MIME type, size, and checksum. 'IMAGE' assets must have an
+// 'image/*' MIME type other than SVG, which may carry script. Data over
+// maxAssetSize is rejected with 413 Payload Too Large.
+//
+// Each upload is stored under a new blob key which is swapped into the record
+// only once the data is in place, and the replaced blob is removed after the
+// record is committed. Concurrent uploads therefore never leave the record
+// describing one upload while pointing at the bytes of another.
+func StoreContentTypeAssetData(pubID string, mimeType string, data io.Reader, ctx context.Context) (*ContentTypeAsset, rest.RestError) {
+  if blobStore == nil {
+    return nil, rest.ServerError(`No blob store configured.`, nil)
+  }
+
+  c, restErr := GetContentTypeAsset(pubID, ctx)
+  if restErr != nil {
+    return nil, restErr
+  }
+  if mimeType == `` {
+    mimeType = `application/octet-stream`
+  }
+  if c.Type.String == `IMAGE` {
+    mediaType, _, err := mime.ParseMediaType(mimeType)
+    if err != nil || !strings.HasPrefix(mediaType, `image/`) {
+      return nil, rest.BadRequestError(fmt.Sprintf(`Image content requires an image MIME type; got '%s'.`, mimeType), nil)
+    } else if mediaType == `image/svg+xml` {
+      return nil, rest.BadRequestError(`SVG images are not supported; upload SVG as 'FILE' content.`, nil)
+    }
+  }
+
+  key, err := newAssetBlobKey(pubID)
+  if err != nil {
+    return nil, rest.ServerError(fmt.Sprintf(`Could not store data for content '%s'.`, pubID), err)
+  }
+  hash := sha256.New()
+  counter := &countingReader{ reader: io.TeeReader(data, hash), limit: maxAssetSize }
+  if err := blobStore.Put(ctx, key, counter); err != nil {
+    deleteAssetBlob(pubID, key, ctx)
+    if counter.count > maxAssetSize {
+      return nil, newStatusError(http.StatusRequestEntityTooLarge, fmt.Sprintf(`Content data may not exceed %d bytes.`, maxAssetSize), nil)
+    }
+    return nil, rest.ServerError(fmt.Sprintf(`Could not store data for content '%s'.`, pubID), err)
+  }
+  checksum := hex.EncodeToString(hash.Sum(nil))
+
+  c, previousKey, restErr := recordContentTypeAssetData(pubID, mimeType, counter.count, checksum, key, ctx)
+  if restErr != nil {
+    deleteAssetBlob(pubID, key, ctx)
+    return nil, restErr
+  }
+  deleteAssetBlob(pubID, previousKey, ctx)
+
+  return c, nil
+}
+
+// recordContentTypeAssetData points the asset record at newly stored data.
+// Returns the updated record and the blob key of the data replaced.
+func recordContentTypeAssetData(pubID string, mimeType string, size int64, checksum string, key string, ctx context.Context) (*ContentTypeAsset, string, rest.RestError) {
+  txn, err := sqldb.DB.Begin()
+  if err != nil {
+    return nil, ``, rest.ServerError("Could not update content record. (txn error)", err)
+  }
+
+  var previousKey nulls.String
+  err = txn.Stmt(lockContentTypeAssetBlobKeyStmt).QueryRowContext(ctx, pubID).Scan(&previousKey)
+  if err == sql.ErrNoRows {
+    defer txn.Rollback()
+    return nil, ``, rest.NotFoundError(fmt.Sprintf(`Content '%s' not found.`, pubID), nil)
+  } else if err != nil {
+    defer txn.Rollback()
+    return nil, ``, rest.ServerError(fmt.Sprintf(`Could not lock content '%s' for update.`, pubID), err)
+  }
+
+  if _, err := txn.Stmt(updateContentTypeAssetDataStmt).ExecContext(ctx, mimeType, size, checksum, key, pubID); err != nil {
+    defer txn.Rollback()
+    return nil, ``, rest.ServerError(fmt.Sprintf(`Could not update record for content '%s'.`, pubID), err)
+  }
+  c, restErr := getContentTypeAssetHelper(getContentTypeAssetStmt, ctx, txn, pubID)
+  if restErr != nil {
+    defer txn.Rollback()
+    return nil, ``, restErr
+  }
+  if restErr := recordAssetRevisionInTxn(c, ctx, txn); restErr != nil {
+    return nil, ``, restErr // already rolled back
+  }
+  if err := txn.Commit(); err != nil {
+    return nil, ``, rest.ServerError("Could not update content record. (commit error)", err)
+  }
+
+  return c, assetBlobKey(pubID, previousKey), nil
+}
+
+// deleteAssetBlob removes a blob which is no longer referenced. Failures are
+// only logged; the orphaned blob is harmless.
+func deleteAssetBlob(pubID string, key string, ctx context.Context) {
+  if err := blobStore.Delete(ctx, key); err != nil {
+    log.Printf("Could not delete unused blob '%s' for content '%s': %v", key, pubID, err)
+  }
+}
+
+// OpenContentTypeAssetData retrieves the asset record and opens the asset
+// bytes for reading. The caller must close the returned reader.
+func OpenContentTypeAssetData(pubID string, ctx context.Context) (*ContentTypeAsset, io.ReadCloser, rest.RestError) {
+  if blobStore == nil {
+    return nil, nil, rest.ServerError(`No blob store configured.`, nil)
+  }
+
+  c, restErr := GetContentTypeAsset(pubID, ctx)
+  if restErr != nil {
+    return nil, nil, restErr
+  }
+  if !c.Checksum.IsValid() {
+    return nil, nil, rest.NotFoundError(fmt.Sprintf(`No data uploaded for content '%s'.`, pubID), nil)
+  }
+
+  reader, err := blobStore.Get(ctx, assetBlobKey(pubID, c.blobKey))
+  if err == ErrBlobNotFound {
+    return nil, nil, rest.NotFoundError(fmt.Sprintf(`Data for content '%s' not found.`, pubID), err)
+  } else if err != nil {
+    return nil, nil, rest.ServerError(fmt.Sprintf(`Could not retrieve data for content '%s'.`, pubID), err)
+  }
+
+  return c, reader, nil
+}
+
+// errAssetTooLarge is returned by countingReader once more than 'limit' bytes
+// have been read.
+var errAssetTooLarge = errors.New(`asset data too large`)
+
+type countingReader struct {
+  reader io.Reader
+  count  int64
+  limit  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+  n, err := r.reader.Read(p)
+  r.count += int64(n)
+  if r.limit > 0 && r.count > r.limit {
+    return n, errAssetTooLarge
+  }
+  return n, err
+}
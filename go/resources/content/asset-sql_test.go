@@ -0,0 +1,69 @@
+package content
+
+import (
+  "context"
+  "database/sql/driver"
+  "testing"
+
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+
+  model "github.com/Liquid-Labs/catalyst-content-model/go/resources/content"
+  queries "github.com/Liquid-Labs/catalyst-content-model/go/resources/content"
+)
+
+func TestCreateContentTypeAssetReadsBackNewAsset(t *testing.T) {
+  const pubID = `5e0ae8b4-4c4c-4a52-a6a4-0c1ad1ef1d1e`
+  var created int64 = -1
+  assetRow := func() []driver.Value {
+    return []driver.Value{pubID, `2026-10-17 00:00:00`, `Logo`, `The logo.`, `site`, `LOCAL`, `logo`, `IMAGE`,
+      nil, nil, nil, nil, nil, nil, nil, nil}
+  }
+  defer useFakeDB(t, map[string]fakeQueryHandler{
+    queries.CreateContentQuery: func(args []driver.Value) ([]string, [][]driver.Value, error) {
+      created = args[0].(int64)
+      return nil, nil, nil
+    },
+    createContentTypeAssetQuery: fakeExec,
+    getContentTypeAssetByIDQuery: func(args []driver.Value) ([]string, [][]driver.Value, error) {
+      if id, ok := args[0].(int64); !ok || id != created {
+        return fakeColumns(16), nil, nil
+      }
+      return fakeColumns(16), [][]driver.Value{assetRow()}, nil
+    },
+    getContentTypeAssetQuery: func(args []driver.Value) ([]string, [][]driver.Value, error) {
+      if id, ok := args[0].(string); !ok || id != pubID || created < 0 {
+        return fakeColumns(16), nil, nil
+      }
+      return fakeColumns(16), [][]driver.Value{assetRow()}, nil
+    },
+    lockContentForRevisionQuery: func(args []driver.Value) ([]string, [][]driver.Value, error) {
+      return fakeColumns(1), [][]driver.Value{{created}}, nil
+    },
+    createContentRevisionQuery: fakeExec,
+  })()
+  ctx := context.Background()
+
+  c := &ContentTypeAsset{}
+  c.Title = nulls.NewString(`Logo`)
+  c.Summary = nulls.NewString(`The logo.`)
+  c.Namespace = nulls.NewString(`site`)
+  c.Slug = nulls.NewString(`logo`)
+  c.Type = nulls.NewString(`IMAGE`)
+  c.Contributors = make(model.ContributorSummaries, 0)
+
+  newAsset, restErr := CreateContentTypeAsset(c, ctx)
+  if restErr != nil {
+    t.Fatalf(`could not create asset: %v (%v)`, restErr, restErr.Cause())
+  }
+  if newAsset.PubId.String != pubID || newAsset.Title.String != `Logo` {
+    t.Errorf(`created asset is '%s' ('%s'); expected '%s'`, newAsset.PubId.String, newAsset.Title.String, pubID)
+  }
+
+  readBack, restErr := GetContentTypeAsset(newAsset.PubId.String, ctx)
+  if restErr != nil {
+    t.Fatalf(`could not read back asset: %v`, restErr)
+  }
+  if readBack.PubId.String != pubID || readBack.Type.String != `IMAGE` {
+    t.Errorf(`read back '%s' of type '%s'`, readBack.PubId.String, readBack.Type.String)
+  }
+}
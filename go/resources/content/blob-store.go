@@ -0,0 +1,108 @@
+package content
+
+import (
+  "context"
+  "errors"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+)
+
+// ErrBlobNotFound is returned by BlobStore implementations when retrieving a
+// non-existent blob.
+var ErrBlobNotFound = errors.New(`blob not found`)
+
+// BlobStore stores the bytes for asset content. Keys are opaque strings
+// without path separators. Implementations must be safe for concurrent use.
+// The interface is deliberately minimal so that S3-compatible object stores
+// can be plugged in alongside the LocalBlobStore.
+type BlobStore interface {
+  // Put stores the data under the key, replacing any existing blob.
+  Put(ctx context.Context, key string, data io.Reader) error
+  // Get opens the blob for reading. The caller must close the returned
+  // reader. Returns ErrBlobNotFound if there is no such blob.
+  Get(ctx context.Context, key string) (io.ReadCloser, error)
+  // Delete removes the blob. Deleting a non-existent blob is not an error.
+  Delete(ctx context.Context, key string) error
+}
+
+var blobStore BlobStore
+
+// SetBlobStore configures the BlobStore used for asset content. Must be called
+// before serving asset requests.
+func SetBlobStore(store BlobStore) {
+  blobStore = store
+}
+
+// LocalBlobStore is a BlobStore backed by a local directory.
+type LocalBlobStore struct {
+  Root string
+}
+
+// NewLocalBlobStore creates a LocalBlobStore rooted at 'root', creating the
+// directory if necessary.
+func NewLocalBlobStore(root string) (*LocalBlobStore, error) {
+  if root == `` {
+    return nil, errors.New(`local blob store root must be specified`)
+  }
+  if err := os.MkdirAll(root, 0750); err != nil {
+    return nil, fmt.Errorf(`could not create local blob store root '%s': %v`, root, err)
+  }
+  return &LocalBlobStore{ Root: root }, nil
+}
+
+func (s *LocalBlobStore) path(key string) (string, error) {
+  if key == `` || key == `.` || key == `..` || strings.ContainsAny(key, `/\`) {
+    return ``, fmt.Errorf(`invalid blob key '%s'`, key)
+  }
+  return filepath.Join(s.Root, key), nil
+}
+
+// Put writes to a temporary file which is renamed into place so that readers
+// never see a partial blob.
+func (s *LocalBlobStore) Put(ctx context.Context, key string, data io.Reader) error {
+  path, err := s.path(key)
+  if err != nil {
+    return err
+  }
+  tmp, err := ioutil.TempFile(s.Root, `.upload-`)
+  if err != nil {
+    return err
+  }
+  defer os.Remove(tmp.Name()) // no-op after successful rename
+
+  if _, err := io.Copy(tmp, data); err != nil {
+    tmp.Close()
+    return err
+  }
+  if err := tmp.Close(); err != nil {
+    return err
+  }
+  return os.Rename(tmp.Name(), path)
+}
+
+func (s *LocalBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+  path, err := s.path(key)
+  if err != nil {
+    return nil, err
+  }
+  f, err := os.Open(path)
+  if os.IsNotExist(err) {
+    return nil, ErrBlobNotFound
+  }
+  return f, err
+}
+
+func (s *LocalBlobStore) Delete(ctx context.Context, key string) error {
+  path, err := s.path(key)
+  if err != nil {
+    return err
+  }
+  if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+    return err
+  }
+  return nil
+}
@@ -0,0 +1,159 @@
+package content
+
+import (
+  "context"
+  "database/sql"
+  "fmt"
+  "strconv"
+  "strings"
+
+  "github.com/Liquid-Labs/go-api/sqldb"
+  "github.com/Liquid-Labs/go-rest/rest"
+
+  model "github.com/Liquid-Labs/catalyst-content-model/go/resources/content"
+)
+
+// RequireIfMatch, when true, rejects content updates which do not carry an
+// 'If-Match' header. Otherwise, 'If-Match' is honored when present.
+var RequireIfMatch = false
+
+// ContentETag derives a strong ETag from the latest content revision number.
+// Every change to the content records a revision, so the revision number
+// changes exactly when the content does.
+func ContentETag(revision int64) string {
+  return `"r` + strconv.FormatInt(revision, 10) + `"`
+}
+
+// GetContentETag retrieves the current ETag for the content.
+func GetContentETag(pubID string, ctx context.Context) (string, rest.RestError) {
+  return contentETagHelper(getContentRevisionNumberStmt, pubID, ctx)
+}
+
+func contentETagHelper(stmt *sql.Stmt, pubID string, ctx context.Context) (string, rest.RestError) {
+  var revision int64
+  if err := stmt.QueryRowContext(ctx, pubID).Scan(&revision); err == sql.ErrNoRows {
+    return ``, rest.NotFoundError(fmt.Sprintf(`Content '%s' not found.`, pubID), nil)
+  } else if err != nil {
+    return ``, rest.ServerError(fmt.Sprintf(`Could not determine version of content '%s'.`, pubID), err)
+  }
+  return ContentETag(revision), nil
+}
+
+// matchETag evaluates an 'If-Match' or 'If-None-Match' header against the
+// current ETag. '*' matches any current content and a list matches if any
+// member does. Weak tags ('W/"..."') match only when 'weak' comparison is
+// requested, as for 'If-None-Match'; 'If-Match' requires strong comparison.
+func matchETag(header string, etag string, weak bool) bool {
+  header = strings.TrimSpace(header)
+  if header == `*` {
+    return true
+  }
+  for header != `` {
+    header = strings.TrimLeft(header, " \t,")
+    if header == `` {
+      break
+    }
+    isWeak := strings.HasPrefix(header, `W/`)
+    if isWeak {
+      header = header[2:]
+    }
+    if !strings.HasPrefix(header, `"`) {
+      return false // malformed
+    }
+    end := strings.Index(header[1:], `"`)
+    if end < 0 {
+      return false // malformed
+    }
+    tag := header[:end + 2]
+    header = strings.TrimLeft(header[end + 2:], " \t")
+    if header != `` && header[0] != ',' {
+      return false // malformed
+    }
+    if tag == etag && (weak || !isWeak) {
+      return true
+    }
+  }
+  return false
+}
+
+// checkContentETagInTxn locks the content for update and evaluates 'ifMatch'
+// against the stored ETag. Returns the current ETag and whether the content
+// has moved on (is stale). The transaction is rolled back on error, but not
+// when the content is stale.
+func checkContentETagInTxn(pubID string, ifMatch string, ctx context.Context, txn *sql.Tx) (string, bool, rest.RestError) {
+  currentETag, restErr := contentETagHelper(txn.Stmt(lockContentVersionStmt), pubID, ctx)
+  if restErr != nil {
+    defer txn.Rollback()
+    return ``, false, restErr
+  }
+
+  return currentETag, !matchETag(ifMatch, currentETag, false), nil
+}
+
+// UpdateContentTypeTextIfMatch performs UpdateContentTypeText only if the
+// stored content matches the 'If-Match' header value 'ifMatch'. If the content
+// has been changed since, nothing is updated and the current ETag is returned
+// with 'stale' true.
+func UpdateContentTypeTextIfMatch(c *model.ContentTypeText, ifMatch string, ctx context.Context) (result *model.ContentTypeText, currentETag string, stale bool, restErr rest.RestError) {
+  txn, err := sqldb.DB.Begin()
+  if err != nil {
+    return nil, ``, false, rest.ServerError("Could not update content record. (txn error)", err)
+  }
+
+  if currentETag, stale, restErr = checkContentETagInTxn(c.PubId.String, ifMatch, ctx, txn); restErr != nil {
+    return nil, ``, false, restErr // already rolled back
+  } else if stale {
+    defer txn.Rollback()
+    return nil, currentETag, true, nil
+  }
+
+  if result, restErr = UpdateContentTypeTextInTxn(c, ctx, txn); restErr != nil {
+    return nil, ``, false, restErr // already rolled back
+  }
+  if currentETag, restErr = contentETagHelper(txn.Stmt(getContentRevisionNumberStmt), c.PubId.String, ctx); restErr != nil {
+    defer txn.Rollback()
+    return nil, ``, false, restErr
+  }
+  if err := txn.Commit(); err != nil {
+    return nil, ``, false, rest.ServerError("Could not update content record. (commit error)", err)
+  }
+
+  return result, currentETag, false, nil
+}
+
+// UpdateContentTypeAssetIfMatch performs UpdateContentTypeAsset only if the
+// stored content matches 'ifMatch'. See UpdateContentTypeTextIfMatch.
+func UpdateContentTypeAssetIfMatch(c *ContentTypeAsset, ifMatch string, ctx context.Context) (result *ContentTypeAsset, currentETag string, stale bool, restErr rest.RestError) {
+  txn, err := sqldb.DB.Begin()
+  if err != nil {
+    return nil, ``, false, rest.ServerError("Could not update content record. (txn error)", err)
+  }
+
+  if currentETag, stale, restErr = checkContentETagInTxn(c.PubId.String, ifMatch, ctx, txn); restErr != nil {
+    return nil, ``, false, restErr // already rolled back
+  } else if stale {
+    defer txn.Rollback()
+    return nil, currentETag, true, nil
+  }
+
+  if _, err := txn.Stmt(updateContentSummaryStmt).ExecContext(ctx, c.Title, c.Summary, c.Slug, c.PubId); err != nil {
+    defer txn.Rollback()
+    return nil, ``, false, rest.ServerError("Could not update content record.", err)
+  }
+  if result, restErr = getContentTypeAssetHelper(getContentTypeAssetStmt, ctx, txn, c.PubId.String); restErr != nil {
+    defer txn.Rollback()
+    return nil, ``, false, restErr
+  }
+  if restErr = recordAssetRevisionInTxn(result, ctx, txn); restErr != nil {
+    return nil, ``, false, restErr // already rolled back
+  }
+  if currentETag, restErr = contentETagHelper(txn.Stmt(getContentRevisionNumberStmt), c.PubId.String, ctx); restErr != nil {
+    defer txn.Rollback()
+    return nil, ``, false, restErr
+  }
+  if err := txn.Commit(); err != nil {
+    return nil, ``, false, rest.ServerError("Could not update content record. (commit error)", err)
+  }
+
+  return result, currentETag, false, nil
+}
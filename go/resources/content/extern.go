@@ -2,15 +2,14 @@ package content
 
 import (
   "context"
+  "encoding/json"
   "fmt"
-  "io/ioutil"
+  "io"
   "net/http"
+  neturl "net/url"
   "regexp"
-  "strings"
+  "sync"
 
-  "github.com/xanzy/go-gitlab"
-
-  "github.com/Liquid-Labs/go-api/sqldb"
   "github.com/Liquid-Labs/go-nullable-mysql/nulls"
   "github.com/Liquid-Labs/go-rest/rest"
 
@@ -19,8 +18,9 @@ import (
 
 var httpRE *regexp.Regexp = regexp.MustCompile(`^https?://`)
 
-// SyncContentTypeText is incomplete. It's an untested, partially stubbed method
-// kept in place so we can start verifying flow and test with non-external data.
+// SyncContentTypeText updates URL-sourced text from the external resource.
+// Content from a content source is synced with its namespace instead; see
+// SyncContentSource.
 func SyncContentTypeText(c *model.ContentTypeText, ctx context.Context) (*model.ContentTypeText, rest.RestError) {
   if !c.ExternPath.IsValid() { // nothing to do
     return c, nil
@@ -35,120 +35,226 @@ func SyncContentTypeText(c *model.ContentTypeText, ctx context.Context) (*model.
   if c.SourceType.String == `NONE` {
     // Nothing to do.
     return c, nil
+  } else if c.SourceType.String == `URL` {
+    if !httpRE.MatchString(externPath) {
+      return nil, rest.ServerError(fmt.Sprintf(`URL-type resource references non-HTTP(S) URL: %s`, externPath), nil)
+    }
+    return syncURLContentTypeText(c, ctx)
+  } else if _, ok := contentSourceTypes[c.SourceType.String]; ok {
+    // Content source content is synced with its namespace; see
+    // SyncContentSource.
+    return c, nil
   } else {
-    if c.SourceType.String == `URL` {
-      if !httpRE.MatchString(externPath) {
-        return nil, rest.ServerError(fmt.Sprintf(`URL-type resource references non-HTTP(S) URL: %s`, externPath), nil)
-      }
+    return nil, rest.ServerError(fmt.Sprintf(`Failed to sync content with unknown source type: '%s'`, c.SourceType), nil)
+  }
+}
 
-      if response, err := http.Get(externPath); err != nil {
-        return nil, rest.ServerError(fmt.Sprintf(`Could not retrieve external content from '%s'.`, externPath), err)
-      } else {
-        defer response.Body.Close()
-        if body, err := ioutil.ReadAll(response.Body); err != nil {
-          return nil, rest.ServerError(fmt.Sprintf(`Could not read external content body from '%s'.`, externPath), err)
-        } else {
-          c.Text = nulls.NewString(fmt.Sprintf(`%s`, body))
-          c.LastSync = nulls.NewInt64(0) // will be updated by trigger
-        }
-      }
-    // c.SourceType == `URL
-    } else if c.SourceType.String == `GITLAB` {
-      rest.ServerError(`GitLab content sync not yet implemented.`, nil)
-    // c.SourceType == `GITLAB`
-    } else {
-      return nil, rest.ServerError(fmt.Sprintf(`Failed to sync content with unknown source type: '%s'`, c.SourceType), nil)
+// urlVersionCookie holds the HTTP validators from the last successful fetch of
+// URL-sourced content.
+type urlVersionCookie struct {
+  ETag         string `json:"etag,omitempty"`
+  LastModified string `json:"lastModified,omitempty"`
+}
+
+// syncURLContentTypeText fetches the URL, conditionally when the last fetch
+// provided validators. The record is left untouched when the resource is
+// unmodified.
+func syncURLContentTypeText(c *model.ContentTypeText, ctx context.Context) (*model.ContentTypeText, rest.RestError) {
+  externPath := c.ExternPath.String
+
+  var cookie urlVersionCookie
+  if !c.VersionCookie.IsEmpty() {
+    // An unparsable cookie just results in an unconditional fetch.
+    json.Unmarshal([]byte(c.VersionCookie.String), &cookie)
+  }
+
+  header := make(http.Header)
+  // Without local text, there's nothing for a '304' to confirm.
+  if !c.Text.IsEmpty() {
+    if cookie.ETag != `` {
+      header.Set(`If-None-Match`, cookie.ETag)
+    }
+    if cookie.LastModified != `` {
+      header.Set(`If-Modified-Since`, cookie.LastModified)
     }
+  }
+
+  policy, restErr := namespaceURLPolicy(c.Namespace.String, ctx)
+  if restErr != nil {
+    return nil, restErr
+  }
+  if parsed, err := neturl.Parse(externPath); err != nil {
+    return nil, rest.UnprocessableEntityError(fmt.Sprintf(`Invalid URL '%s'.`, externPath), err)
+  } else if err := policy.checkURL(parsed); err != nil {
+    return nil, rest.UnprocessableEntityError(fmt.Sprintf(`Refused to retrieve external content from '%s': %v.`, externPath, err), err)
+  }
+
+  response, restErr := DefaultURLFetcher.Fetch(withURLPolicy(ctx, policy), externPath, header, c.Format.String)
+  if restErr != nil {
+    return nil, restErr
+  }
+  if response.StatusCode == http.StatusNotModified {
+    return c, nil
+  }
+  body := response.Body
 
-    if newC, err := UpdateContentTypeText(c, ctx); err != nil {
-      return nil, err
-    } else {
-      return newC, nil
+  cookie = urlVersionCookie{ ETag: response.Header.Get(`ETag`), LastModified: response.Header.Get(`Last-Modified`) }
+  versionCookie := nulls.NewNullString()
+  if cookie.ETag != `` || cookie.LastModified != `` {
+    if encoded, err := json.Marshal(cookie); err == nil {
+      versionCookie = nulls.NewString(string(encoded))
     }
   }
+
+  update := &model.ContentTypeText{}
+  update.PubId = c.PubId
+  update.VersionCookie = versionCookie
+  if err := applyFrontMatter(update, c.Format.String, body); err != nil {
+    return nil, rest.UnprocessableEntityError(fmt.Sprintf(`Could not parse external content from '%s'.`, externPath), err)
+  }
+  // Servers without validators always respond in full; don't record a revision
+  // for unchanged content.
+  if c.Text.IsValid() && c.VersionCookie.String == versionCookie.String && !syncedContentChanged(update, c) {
+    return c, nil
+  }
+
+  return UpdateSyncedContentTypeText(update, WithRevisionSource(ctx, RevisionSourceSync))
 }
 
-// SyncContentSource is incomplete. It's an untested, partially stubbed method
-// kept in place so we can start testing flow with non-external Content.
-func SyncContentSource(cs *model.ContentSource, ctx context.Context) (*model.ContentSource, rest.RestError) {
-  // TODO: the current logic could be inconsistent as it uses 'master' which
-  // may change as the files are processed. To avoid this, we should start by
-  // getting the current master commit ref and then use that in all subsequent
-  // calls.
-  if cs.SourceType.String == `GITLAB` {
-    apiHost := cs.Config[`apiHost`]
-    if apiHost.IsEmpty() {
-      return nil, rest.ServerError(`Failed to sync GitLab source; no 'apiHost' configuration found.`, nil)
-    }
-    apiToken := cs.Config[`apiToken`]
-    projectID := cs.Config[`projectID`]
-    if projectID.IsEmpty() {
-      return nil, rest.ServerError(`Failed to sync GitLab source; no 'projectID' configuration found.`, nil)
-    }
-    contentPath := cs.Config[`contentPath`]
-
-    recursive := true
-    git := gitlab.NewClient(nil, apiToken.String)
-    git.SetBaseURL(`https://` + apiHost.String + `/api/v4`)
-    var lastResponse *gitlab.Response = nil
-    pathCommitMap := make(map[string]string)
-    listTreeOptions := &gitlab.ListTreeOptions{
-      ListOptions : gitlab.ListOptions{ Page: 0, PerPage: 100 },
-      Recursive   : &recursive,
+// syncedContentChanged determines whether the synced text or any set metadata
+// differ from the current content.
+func syncedContentChanged(update *model.ContentTypeText, current *model.ContentTypeText) bool {
+  if update.Text.String != current.Text.String ||
+      (update.Title.IsValid() && update.Title.String != current.Title.String) ||
+      (update.Summary.IsValid() && update.Summary.String != current.Summary.String) ||
+      (update.Slug.IsValid() && update.Slug.String != current.Slug.String) ||
+      (update.Format.IsValid() && update.Format.String != current.Format.String) {
+    return true
+  }
+  if update.Contributors != nil {
+    if len(update.Contributors) != len(current.Contributors) {
+      return true
     }
-    // build out the 'pathCommitMap'
-    for lastResponse == nil || lastResponse.NextPage != 0 {
-      treeNodes, lastResponse, err := git.Repositories.ListTree(projectID.String, listTreeOptions)
-      if err != nil {
-        // TODO: check response and return appropriate error type
-        return nil, rest.ServerError(fmt.Sprintf(`Problem while retrieving GitLab tree for project '%s' from '%s'.`, projectID, apiHost), err)
+    for i, contrib := range update.Contributors {
+      if contrib.PubId.String != current.Contributors[i].PubId.String || contrib.Role.String != current.Contributors[i].Role.String {
+        return true
       }
+    }
+  }
+  return false
+}
 
-      for _, treeNode := range treeNodes {
-        path := treeNode.Path
-        var ref string = `master`
-        if treeNode.Type == `blob` && (contentPath.IsEmpty() || strings.HasPrefix(path, contentPath.String)) {
-          // TODO: pay attention to response?
-          fileMetaData, _, err := git.RepositoryFiles.GetFileMetaData(projectID.String, path, &gitlab.GetFileMetaDataOptions{&ref})
-          if err != nil {
-            // TODO: check response and return appropriate error type
-            return nil, rest.ServerError(fmt.Sprintf(`Problem while retrieving GitLab file '%s' for project '%s' from '%s'.`, treeNode.Path, projectID, apiHost), err)
-          }
-
-          pathCommitMap[path] = fileMetaData.CommitID
-        }
-      }
+// SyncFailure describes an item which could not be synced.
+type SyncFailure struct {
+  ExternPath string `json:"externPath"`
+  Message    string `json:"message"`
+}
 
-      listTreeOptions.Page = lastResponse.NextPage
-    }
+// SyncSummary reports the outcome of a SyncContentSource run.
+type SyncSummary struct {
+  Source   string         `json:"source"`
+  // Version identifies the source version (e.g., commit) synced.
+  Version  string         `json:"version"`
+  Created  int            `json:"created"`
+  Updated  int            `json:"updated"`
+  Deleted  int            `json:"deleted"`
+  Failed   int            `json:"failed"`
+  Failures []*SyncFailure `json:"failures"`
+}
 
-    // new we have the 'pathCommitMap', we go to the DB and select everything
-    currentRecordsQuery := `SELECT cs.id, cs.extern_path, cs.version_cookie FROM content_summary cs JOIN namespace ns ON cs.namespace=ns.id WHERE ns.name=?`
+func (s *SyncSummary) addFailure(externPath string, err error) {
+  s.Failed += 1
+  s.Failures = append(s.Failures, &SyncFailure{ ExternPath: externPath, Message: err.Error() })
+}
 
-    rows, err := sqldb.DB.QueryContext(ctx, currentRecordsQuery, cs.Name)
-    if err != nil {
-      return nil, rest.ServerError(`Problem while gathering current records.`, err)
-    }
+// SyncContentSource reconciles the content source namespace with the source
+// and records the sync run. Syncs of the same source, whether scheduled,
+// requested, or triggered by a webhook, run one at a time; see
+// lockContentSource. See also reconcileContentSource and WithSyncTrigger.
+func SyncContentSource(cs *model.ContentSource, ctx context.Context) (*SyncSummary, rest.RestError) {
+  unlock, restErr := lockContentSource(cs, ctx)
+  if restErr != nil {
+    return nil, restErr
+  }
+  defer unlock()
 
-    for rows.Next() {
-      var id int64
-      var externPath, versionCookie string
-      rows.Scan(&id, &externPath, &versionCookie)
+  return recordSyncRun(cs, syncTrigger(ctx), ctx, func(ctx context.Context) (*SyncSummary, rest.RestError) {
+    return syncContentSource(cs, ctx)
+  })
+}
 
+// contentSourceLocks holds a single slot channel for each content source (by
+// public ID) which has been synced.
+var contentSourceLocks = struct {
+  sync.Mutex
+  slots map[string]chan struct{}
+}{ slots: make(map[string]chan struct{}) }
 
-      /*
-      currentVersion, valid := pathCommitMap[externPath]
-      if !valid { // then we have a record for something that no longer exists
-        if err := DeleteContentTypeTextByID(*id) {
-          return nil, rest.ServerError(fmt.Sprintf(`Problem deleting stale record for %s/%s.`, cs.ContentNamespace.Name, externPath), err)
-        }
-      } else if currentVersion != versionCookie {
-        ctt := &model.ContentTypeText{
+// lockContentSource waits until no other sync of the content source is running
+// and returns the function to release it. Concurrent syncs would otherwise
+// race to create, update, and delete the same items. Waiting ends with an
+// error if the context is done first.
+func lockContentSource(cs *model.ContentSource, ctx context.Context) (func(), rest.RestError) {
+  contentSourceLocks.Lock()
+  slot, ok := contentSourceLocks.slots[cs.PubId.String]
+  if !ok {
+    slot = make(chan struct{}, 1)
+    contentSourceLocks.slots[cs.PubId.String] = slot
+  }
+  contentSourceLocks.Unlock()
 
-        }
-      }*/
-    }
+  select {
+  case slot <- struct{}{}:
+    return func() { <-slot }, nil
+  case <-ctx.Done():
+    return nil, rest.ServerError(fmt.Sprintf(`Gave up waiting on sync of content source '%s' already in progress.`, cs.Name.String), ctx.Err())
+  }
+}
+
+func syncContentSource(cs *model.ContentSource, ctx context.Context) (*SyncSummary, rest.RestError) {
+  reader, restErr := newContentSourceReader(cs, ctx)
+  if restErr != nil {
+    return nil, restErr
+  }
+  if closer, ok := reader.(io.Closer); ok {
+    defer closer.Close()
+  }
+
+  summary := &SyncSummary{ Source: cs.Name.String, Failures: make([]*SyncFailure, 0) }
+  if restErr := reconcileContentSource(cs, reader, summary, ctx); restErr != nil {
+    return nil, restErr
+  }
+
+  return summary, nil
+}
+
+// newContentSourceReader creates the reader for the content source type, with
+// the source secrets decrypted. The caller must close the reader if it is an
+// io.Closer.
+func newContentSourceReader(cs *model.ContentSource, ctx context.Context) (contentSourceReader, rest.RestError) {
+  cs, restErr := withContentSourceSecrets(cs, ctx)
+  if restErr != nil {
+    return nil, restErr
+  }
+  var reader contentSourceReader
+  var err error
+  switch cs.SourceType.String {
+  case `GITLAB`:
+    reader, err = newGitlabSourceReader(cs)
+  case `GITHUB`:
+    reader, err = newGithubSourceReader(cs, ctx)
+  case `GIT`:
+    reader, err = newGitSourceReader(cs, ctx)
+  case `LOCAL_DIR`:
+    reader, err = newLocalDirSourceReader(cs)
+  case `S3`:
+    reader, err = newS3SourceReader(cs)
+  default:
+    return nil, rest.BadRequestError(fmt.Sprintf(`Cannot sync content source with unknown source type: '%s'`, cs.SourceType.String), nil)
+  }
+  if err != nil {
+    return nil, rest.ServerError(fmt.Sprintf(`Failed to sync %s source '%s'.`, cs.SourceType.String, cs.Name.String), err)
   }
 
-  return cs, nil
+  return reader, nil
 }
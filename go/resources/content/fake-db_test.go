@@ -0,0 +1,173 @@
+package content
+
+import (
+  "database/sql"
+  "database/sql/driver"
+  "fmt"
+  "io"
+  "sync"
+  "testing"
+
+  "github.com/Liquid-Labs/go-api/sqldb"
+)
+
+// fakeQueryHandler answers a query with the result columns and rows. Rows are
+// ignored for statements run with Exec.
+type fakeQueryHandler func(args []driver.Value) ([]string, [][]driver.Value, error)
+
+// fakeDB is a database/sql driver which answers each query from a handler
+// registered for the exact query text. Unexpected queries fail. Transactions
+// are accepted but have no effect.
+type fakeDB struct {
+  mu       sync.Mutex
+  handlers map[string]fakeQueryHandler
+  executed []string
+}
+
+var fakeDBInstance = &fakeDB{}
+
+func init() {
+  sql.Register(`fakedb`, fakeDBInstance)
+}
+
+// useFakeDB prepares the statements against a fake database answering with
+// the handlers. The returned function restores sqldb.DB.
+func useFakeDB(t *testing.T, handlers map[string]fakeQueryHandler) func() {
+  fakeDBInstance.mu.Lock()
+  fakeDBInstance.handlers = handlers
+  fakeDBInstance.executed = nil
+  fakeDBInstance.mu.Unlock()
+
+  db, err := sql.Open(`fakedb`, ``)
+  if err != nil {
+    t.Fatal(err)
+  }
+  previous := sqldb.DB
+  sqldb.DB = db
+  SetupDB(db)
+  return func() {
+    sqldb.DB = previous
+    db.Close()
+  }
+}
+
+// fakeDBExecuted lists the queries run, in order.
+func fakeDBExecuted() []string {
+  fakeDBInstance.mu.Lock()
+  defer fakeDBInstance.mu.Unlock()
+  return append([]string{}, fakeDBInstance.executed...)
+}
+
+func (d *fakeDB) Open(name string) (driver.Conn, error) {
+  return &fakeConn{ db: d }, nil
+}
+
+func (d *fakeDB) handle(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+  d.mu.Lock()
+  handler, ok := d.handlers[query]
+  d.executed = append(d.executed, query)
+  d.mu.Unlock()
+  if !ok {
+    return nil, nil, fmt.Errorf(`unexpected query: %s`, query)
+  }
+  return handler(args)
+}
+
+type fakeConn struct {
+  db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+  return &fakeStmt{ db: c.db, query: query }, nil
+}
+
+func (c *fakeConn) Close() error {
+  return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+  return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+  return nil
+}
+
+func (c *fakeConn) Rollback() error {
+  return nil
+}
+
+type fakeStmt struct {
+  db    *fakeDB
+  query string
+}
+
+func (s *fakeStmt) Close() error {
+  return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+  return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+  if _, _, err := s.db.handle(s.query, args); err != nil {
+    return nil, err
+  }
+  return fakeResult{}, nil
+}
+
+// fakeResult reports a single row affected, with ID 1.
+type fakeResult struct{}
+
+func (fakeResult) LastInsertId() (int64, error) {
+  return 1, nil
+}
+
+func (fakeResult) RowsAffected() (int64, error) {
+  return 1, nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+  columns, rows, err := s.db.handle(s.query, args)
+  if err != nil {
+    return nil, err
+  }
+  return &fakeRows{ columns: columns, rows: rows }, nil
+}
+
+type fakeRows struct {
+  columns []string
+  rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+  return r.columns
+}
+
+func (r *fakeRows) Close() error {
+  return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+  if len(r.rows) == 0 {
+    return io.EOF
+  }
+  copy(dest, r.rows[0])
+  r.rows = r.rows[1:]
+  return nil
+}
+
+// fakeExec is a handler for statements whose result is not inspected.
+func fakeExec(args []driver.Value) ([]string, [][]driver.Value, error) {
+  return nil, nil, nil
+}
+
+// fakeColumns names n result columns.
+func fakeColumns(n int) []string {
+  columns := make([]string, n)
+  for i := range columns {
+    columns[i] = fmt.Sprintf(`c%d`, i)
+  }
+  return columns
+}
@@ -0,0 +1,320 @@
+package content
+
+import (
+  "context"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "mime"
+  "net"
+  "net/http"
+  neturl "net/url"
+  "strconv"
+  "strings"
+  "syscall"
+  "time"
+
+  "github.com/Liquid-Labs/go-rest/rest"
+)
+
+// URLFetcher retrieves URL-sourced content. Each attempt is bound by the
+// client timeouts and the whole fetch, including retries, by TotalTimeout.
+// Server errors ('5xx') and '429 Too Many Requests' are retried with
+// exponential backoff, honoring any 'Retry-After' up to MaxBackoff.
+//
+// The default client connects only to public addresses (see AllowPrivateURLs)
+// and applies any URL policy in the request context to redirects. Proxies are
+// not used, as they would bypass the address checks.
+type URLFetcher struct {
+  Client         *http.Client
+  MaxBodySize    int64
+  MaxRetries     int
+  InitialBackoff time.Duration
+  MaxBackoff     time.Duration
+  TotalTimeout   time.Duration
+}
+
+// DefaultURLFetcher is used to sync URL-sourced content.
+var DefaultURLFetcher = NewURLFetcher()
+
+const maxURLRedirects = 5
+
+var errTooManyRedirects = fmt.Errorf(`stopped after %d redirects`, maxURLRedirects)
+
+// errBlockedAddress is wrapped by connection and redirect errors refused by
+// the URL policy.
+type errBlockedAddress struct {
+  err error
+}
+
+func (e *errBlockedAddress) Error() string {
+  return e.err.Error()
+}
+
+// dialControl refuses connections to blocked addresses. It runs after DNS
+// resolution, so rebinding the host between checks does not help.
+func dialControl(network string, address string, conn syscall.RawConn) error {
+  host, _, err := net.SplitHostPort(address)
+  if err != nil {
+    return &errBlockedAddress{ err }
+  }
+  ip := net.ParseIP(host)
+  if ip == nil {
+    return &errBlockedAddress{ fmt.Errorf(`unexpected dial address '%s'`, address) }
+  }
+  if err := checkIP(ip); err != nil {
+    return &errBlockedAddress{ err }
+  }
+  return nil
+}
+
+// NewURLFetcher creates a URLFetcher with conservative defaults.
+func NewURLFetcher() *URLFetcher {
+  transport := &http.Transport{
+    DialContext           : (&net.Dialer{ Timeout: 5 * time.Second, KeepAlive: 30 * time.Second, Control: dialControl }).DialContext,
+    TLSHandshakeTimeout   : 5 * time.Second,
+    ResponseHeaderTimeout : 10 * time.Second,
+    IdleConnTimeout       : 90 * time.Second,
+    MaxIdleConns          : 100,
+  }
+  return &URLFetcher{
+    Client         : &http.Client{
+      Transport     : transport,
+      Timeout       : 30 * time.Second,
+      CheckRedirect : func(request *http.Request, via []*http.Request) error {
+        if len(via) >= maxURLRedirects {
+          return errTooManyRedirects
+        }
+        if err := contextURLPolicy(request.Context()).checkURL(request.URL); err != nil {
+          return &errBlockedAddress{ fmt.Errorf(`redirect refused: %v`, err) }
+        }
+        return nil
+      },
+    },
+    MaxBodySize    : 5 << 20,
+    MaxRetries     : 3,
+    InitialBackoff : 500 * time.Millisecond,
+    MaxBackoff     : 8 * time.Second,
+    TotalTimeout   : 60 * time.Second,
+  }
+}
+
+// sourceAPIClient is used to call content source APIs, such as GitHub and S3.
+// It shares the URL content transport, so a configured API URL or endpoint is
+// subject to the same address checks as URL content.
+var sourceAPIClient = NewURLFetcher().Client
+
+// Limits on content source API responses. A listing may be much larger than
+// any single item.
+const (
+  maxSourceItemSize    = 5 << 20  // 5MiB
+  maxSourceListingSize = 32 << 20 // 32MiB
+)
+
+// checkSourceAPIURL verifies the scheme and host of a configured content
+// source API URL. Addresses are checked on connection by sourceAPIClient.
+func checkSourceAPIURL(apiURL string) (*neturl.URL, error) {
+  parsed, err := neturl.Parse(apiURL)
+  if err != nil {
+    return nil, fmt.Errorf(`invalid URL: %v`, err)
+  }
+  if err := (&urlPolicy{}).checkURL(parsed); err != nil {
+    return nil, err
+  }
+  return parsed, nil
+}
+
+// readLimited reads the whole of 'r', failing if it holds more than 'limit'
+// bytes.
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+  body, err := ioutil.ReadAll(io.LimitReader(r, limit + 1))
+  if err != nil {
+    return nil, err
+  }
+  if int64(len(body)) > limit {
+    return nil, errResponseTooLarge(limit)
+  }
+  return body, nil
+}
+
+func errResponseTooLarge(limit int64) error {
+  return fmt.Errorf(`response exceeds the maximum size of %d bytes`, limit)
+}
+
+// limitedBodyClient returns a copy of the client whose response bodies fail
+// once more than 'limit' bytes are read. It is for API clients, such as
+// GitLab's, which read responses themselves.
+func limitedBodyClient(client *http.Client, limit int64) *http.Client {
+  transport := client.Transport
+  if transport == nil {
+    transport = http.DefaultTransport
+  }
+  limited := *client
+  limited.Transport = &limitedBodyTransport{ base: transport, limit: limit }
+  return &limited
+}
+
+type limitedBodyTransport struct {
+  base  http.RoundTripper
+  limit int64
+}
+
+func (t *limitedBodyTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+  response, err := t.base.RoundTrip(request)
+  if err != nil {
+    return nil, err
+  }
+  response.Body = &limitedBody{ ReadCloser: response.Body, limit: t.limit, remaining: t.limit }
+  return response, nil
+}
+
+type limitedBody struct {
+  io.ReadCloser
+  limit     int64
+  remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+  if int64(len(p)) > b.remaining + 1 {
+    p = p[:b.remaining + 1]
+  }
+  n, err := b.ReadCloser.Read(p)
+  b.remaining -= int64(n)
+  if b.remaining < 0 {
+    return n, errResponseTooLarge(b.limit)
+  }
+  return n, err
+}
+
+// acceptedMimeTypes lists the response media types accepted for each text
+// Format. A response without a 'Content-Type' is accepted.
+var acceptedMimeTypes = map[string][]string{
+  `MARKDOWN`: {`text/markdown`, `text/x-markdown`, `text/plain`},
+  `HTML`    : {`text/html`, `application/xhtml+xml`},
+  `TEXT`    : {`text/plain`, `text/markdown`, `text/x-markdown`, `text/html`, `text/csv`},
+}
+
+// urlFetchResult is a successful ('200') or unmodified ('304') response.
+type urlFetchResult struct {
+  StatusCode int
+  Header     http.Header
+  Body       []byte
+}
+
+// Fetch retrieves the URL for content of the given Format. The header is sent
+// with each attempt (e.g., for conditional requests).
+func (f *URLFetcher) Fetch(ctx context.Context, url string, header http.Header, format string) (*urlFetchResult, rest.RestError) {
+  ctx, cancel := context.WithTimeout(ctx, f.TotalTimeout)
+  defer cancel()
+
+  backoff := f.InitialBackoff
+  for attempt := 0; ; attempt++ {
+    result, retryDelay, err := f.fetchOnce(ctx, url, header, format)
+    if err == nil {
+      return result, nil
+    }
+    if retryDelay < 0 || attempt >= f.MaxRetries || ctx.Err() != nil {
+      return nil, err
+    }
+
+    delay := backoff
+    if retryDelay > delay {
+      delay = retryDelay
+    }
+    if delay > f.MaxBackoff {
+      delay = f.MaxBackoff
+    }
+    select {
+    case <-ctx.Done():
+      return nil, err
+    case <-time.After(delay):
+    }
+    backoff *= 2
+  }
+}
+
+// fetchOnce makes a single attempt. A non-negative retry delay indicates the
+// error may be retried; a positive delay is the server requested minimum.
+func (f *URLFetcher) fetchOnce(ctx context.Context, url string, header http.Header, format string) (*urlFetchResult, time.Duration, rest.RestError) {
+  request, err := http.NewRequest(`GET`, url, nil)
+  if err != nil {
+    return nil, -1, rest.ServerError(fmt.Sprintf(`Could not build request for '%s'.`, url), err)
+  }
+  request = request.WithContext(ctx)
+  for name, values := range header {
+    request.Header[name] = values
+  }
+  if accepted, ok := acceptedMimeTypes[format]; ok {
+    request.Header.Set(`Accept`, strings.Join(accepted, `, `))
+  }
+
+  response, err := f.Client.Do(request)
+  if err != nil {
+    if blocked := blockedAddressError(err); blocked != nil {
+      return nil, -1, rest.UnprocessableEntityError(fmt.Sprintf(`Refused to retrieve external content from '%s': %v.`, url, blocked), err)
+    }
+    if urlErr, ok := err.(*neturl.Error); ok && urlErr.Err == errTooManyRedirects {
+      return nil, -1, rest.ServerError(fmt.Sprintf(`Could not retrieve external content from '%s'.`, url), err)
+    }
+    return nil, 0, rest.ServerError(fmt.Sprintf(`Could not retrieve external content from '%s'.`, url), err)
+  }
+  defer response.Body.Close()
+
+  switch {
+  case response.StatusCode == http.StatusNotModified:
+    return &urlFetchResult{ StatusCode: response.StatusCode, Header: response.Header }, 0, nil
+  case response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500:
+    return nil, retryAfter(response), rest.ServerError(fmt.Sprintf(`Could not retrieve external content from '%s'; received '%s'.`, url, response.Status), nil)
+  case response.StatusCode != http.StatusOK:
+    return nil, -1, rest.ServerError(fmt.Sprintf(`Could not retrieve external content from '%s'; received '%s'.`, url, response.Status), nil)
+  }
+
+  if contentType := response.Header.Get(`Content-Type`); contentType != `` {
+    if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || !acceptsMediaType(format, mediaType) {
+      return nil, -1, rest.UnprocessableEntityError(fmt.Sprintf(`External content from '%s' has type '%s', which is not acceptable for format '%s'.`, url, contentType, format), err)
+    }
+  }
+
+  body, err := ioutil.ReadAll(io.LimitReader(response.Body, f.MaxBodySize + 1))
+  if err != nil {
+    return nil, 0, rest.ServerError(fmt.Sprintf(`Could not read external content body from '%s'.`, url), err)
+  }
+  if int64(len(body)) > f.MaxBodySize {
+    return nil, -1, rest.UnprocessableEntityError(fmt.Sprintf(`External content from '%s' exceeds the maximum size of %d bytes.`, url, f.MaxBodySize), nil)
+  }
+
+  return &urlFetchResult{ StatusCode: response.StatusCode, Header: response.Header, Body: body }, 0, nil
+}
+
+// blockedAddressError finds any errBlockedAddress within a client error.
+func blockedAddressError(err error) *errBlockedAddress {
+  if urlErr, ok := err.(*neturl.Error); ok {
+    err = urlErr.Err
+  }
+  if opErr, ok := err.(*net.OpError); ok {
+    err = opErr.Err
+  }
+  blocked, _ := err.(*errBlockedAddress)
+  return blocked
+}
+
+func acceptsMediaType(format string, mediaType string) bool {
+  accepted, ok := acceptedMimeTypes[format]
+  if !ok { // unknown formats are not restricted
+    return true
+  }
+  for _, acceptedType := range accepted {
+    if mediaType == acceptedType {
+      return true
+    }
+  }
+  return false
+}
+
+// retryAfter reads a 'Retry-After' given in seconds; HTTP dates are ignored.
+func retryAfter(response *http.Response) time.Duration {
+  if seconds, err := strconv.Atoi(response.Header.Get(`Retry-After`)); err == nil && seconds > 0 {
+    return time.Duration(seconds) * time.Second
+  }
+  return 0
+}
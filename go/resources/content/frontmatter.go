@@ -0,0 +1,175 @@
+package content
+
+import (
+  "bytes"
+  "fmt"
+  "regexp"
+  "strings"
+
+  "github.com/BurntSushi/toml"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "gopkg.in/yaml.v2"
+
+  model "github.com/Liquid-Labs/catalyst-content-model/go/resources/content"
+)
+
+// frontMatter is the content metadata which may lead a synced Markdown
+// document, either as YAML delimited by '---' lines or as TOML delimited by
+// '+++' lines. E.g.:
+//
+//   ---
+//   title: Getting Started
+//   summary: Your first steps.
+//   contributors:
+//     - id: 3b2d7c4e-...
+//       role: AUTHOR
+//   ---
+//
+// Fields which are not given leave the corresponding content field as is.
+// Other keys are ignored.
+type frontMatter struct {
+  Title        *string                   `yaml:"title" toml:"title"`
+  Summary      *string                   `yaml:"summary" toml:"summary"`
+  Slug         *string                   `yaml:"slug" toml:"slug"`
+  Format       *string                   `yaml:"format" toml:"format"`
+  Contributors []*frontMatterContributor `yaml:"contributors" toml:"contributors"`
+}
+
+// frontMatterContributor references a contributor by public ID. The role
+// defaults to 'AUTHOR'. Credit order follows the listing order.
+type frontMatterContributor struct {
+  ID   string `yaml:"id" toml:"id"`
+  Role string `yaml:"role" toml:"role"`
+}
+
+var textFormats = map[string]bool{ `MARKDOWN`: true, `HTML`: true, `TEXT`: true }
+
+var frontMatterIDRe *regexp.Regexp = regexp.MustCompile(`^` + uuidReString + `$`)
+
+// parseFrontMatter separates any front matter from the body. A body without
+// front matter results in nil front matter and the body as is.
+func parseFrontMatter(body []byte) (*frontMatter, []byte, error) {
+  var delimiter string
+  switch {
+  case hasDelimiterLine(body, `---`):
+    delimiter = `---`
+  case hasDelimiterLine(body, `+++`):
+    delimiter = `+++`
+  default:
+    return nil, body, nil
+  }
+
+  // Skip the opening delimiter line and find the closing one.
+  rest := body[bytes.IndexByte(body, '\n') + 1:]
+  offset := 0
+  for {
+    lineEnd := bytes.IndexByte(rest[offset:], '\n')
+    var line []byte
+    if lineEnd == -1 {
+      line = rest[offset:]
+    } else {
+      line = rest[offset:offset + lineEnd]
+    }
+    if string(bytes.TrimRight(line, "\r")) == delimiter {
+      break
+    }
+    if lineEnd == -1 {
+      return nil, nil, fmt.Errorf(`front matter is not closed by '%s'`, delimiter)
+    }
+    offset += lineEnd + 1
+  }
+  matter := rest[:offset]
+  stripped := rest[offset:]
+  if lineEnd := bytes.IndexByte(stripped, '\n'); lineEnd == -1 {
+    stripped = stripped[len(stripped):]
+  } else {
+    stripped = stripped[lineEnd + 1:]
+  }
+
+  fm := &frontMatter{}
+  if delimiter == `---` {
+    if err := yaml.Unmarshal(matter, fm); err != nil {
+      return nil, nil, fmt.Errorf(`invalid YAML front matter: %v`, err)
+    }
+  } else {
+    if _, err := toml.Decode(string(matter), fm); err != nil {
+      return nil, nil, fmt.Errorf(`invalid TOML front matter: %v`, err)
+    }
+  }
+  if err := fm.validate(); err != nil {
+    return nil, nil, err
+  }
+
+  return fm, stripped, nil
+}
+
+func hasDelimiterLine(body []byte, delimiter string) bool {
+  return bytes.HasPrefix(body, []byte(delimiter + "\n")) || bytes.HasPrefix(body, []byte(delimiter + "\r\n"))
+}
+
+func (fm *frontMatter) validate() error {
+  if fm.Slug != nil && (*fm.Slug == `` || slugInvalidRe.MatchString(*fm.Slug)) {
+    return fmt.Errorf(`invalid front matter slug '%s'`, *fm.Slug)
+  }
+  if fm.Format != nil {
+    format := strings.ToUpper(*fm.Format)
+    if !textFormats[format] {
+      return fmt.Errorf(`invalid front matter format '%s'`, *fm.Format)
+    }
+    fm.Format = &format
+  }
+  for _, contributor := range fm.Contributors {
+    if contributor == nil || !frontMatterIDRe.MatchString(contributor.ID) {
+      return fmt.Errorf(`front matter contributors must specify a valid 'id'`)
+    }
+  }
+  return nil
+}
+
+// apply sets the content fields given by the front matter.
+func (fm *frontMatter) apply(c *model.ContentTypeText) {
+  if fm.Title != nil {
+    c.Title = nulls.NewString(*fm.Title)
+  }
+  if fm.Summary != nil {
+    c.Summary = nulls.NewString(*fm.Summary)
+  }
+  if fm.Slug != nil {
+    c.Slug = nulls.NewString(*fm.Slug)
+  }
+  if fm.Format != nil {
+    c.Format = nulls.NewString(*fm.Format)
+  }
+  if fm.Contributors != nil {
+    c.Contributors = make(model.ContributorSummaries, 0, len(fm.Contributors))
+    for i, contributor := range fm.Contributors {
+      role := `AUTHOR`
+      if contributor.Role != `` {
+        role = strings.ToUpper(contributor.Role)
+      }
+      c.Contributors = append(c.Contributors, &model.ContributorSummary{
+        PubId              : nulls.NewString(contributor.ID),
+        Role               : nulls.NewString(role),
+        SummaryCreditOrder : nulls.NewInt64(int64(i + 1)),
+      })
+    }
+  }
+}
+
+// applyFrontMatter sets the content text from the body. Any front matter is
+// stripped from Markdown text and applied to the content.
+func applyFrontMatter(c *model.ContentTypeText, format string, body []byte) error {
+  if format != `MARKDOWN` {
+    c.Text = nulls.NewString(string(body))
+    return nil
+  }
+  fm, stripped, err := parseFrontMatter(body)
+  if err != nil {
+    return err
+  }
+  if fm != nil {
+    fm.apply(c)
+  }
+  c.Text = nulls.NewString(string(stripped))
+  return nil
+}
@@ -0,0 +1,75 @@
+package content
+
+import (
+  "net/http"
+
+  "github.com/gorilla/mux"
+
+  "github.com/Liquid-Labs/catalyst-core-api/go/handlers"
+)
+
+func namespaceCreateHandler(w http.ResponseWriter, r *http.Request) {
+  ns := &Namespace{}
+  if _, restErr := handlers.CheckAndExtract(w, r, ns, `Namespace`); restErr != nil {
+    return // response handled by CheckAndExtract
+  }
+
+  newNS, restErr := CreateNamespace(ns, r.Context())
+  handlers.ProcessGenericResults(w, r, newNS, restErr, `Namespace created.`)
+}
+
+func namespaceListHandler(w http.ResponseWriter, r *http.Request) {
+  if _, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  }
+
+  includeArchived := r.URL.Query().Get(`includeArchived`) == `true`
+  namespaces, restErr := ListNamespaces(includeArchived, r.Context())
+  handlers.ProcessGenericResults(w, r, namespaces, restErr, `List namespaces.`)
+}
+
+func namespaceDetailHandler(w http.ResponseWriter, r *http.Request) {
+  if _, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  }
+
+  ns, restErr := GetNamespace(mux.Vars(r)["name"], r.Context())
+  handlers.ProcessGenericResults(w, r, ns, restErr, `Retrieve namespace.`)
+}
+
+func namespaceUpdateHandler(w http.ResponseWriter, r *http.Request) {
+  ns := &Namespace{}
+  if _, restErr := handlers.CheckAndExtract(w, r, ns, `Namespace`); restErr != nil {
+    return // response handled by CheckAndExtract
+  }
+
+  newNS, restErr := UpdateNamespace(mux.Vars(r)["name"], ns, r.Context())
+  handlers.ProcessGenericResults(w, r, newNS, restErr, `Namespace updated.`)
+}
+
+func namespaceArchiveHandler(w http.ResponseWriter, r *http.Request) {
+  if _, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  }
+
+  ns, restErr := ArchiveNamespace(mux.Vars(r)["name"], r.Context())
+  handlers.ProcessGenericResults(w, r, ns, restErr, `Namespace archived.`)
+}
+
+func namespaceUnarchiveHandler(w http.ResponseWriter, r *http.Request) {
+  if _, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  }
+
+  ns, restErr := UnarchiveNamespace(mux.Vars(r)["name"], r.Context())
+  handlers.ProcessGenericResults(w, r, ns, restErr, `Namespace unarchived.`)
+}
+
+func initNamespaceAPI(r *mux.Router) {
+  r.HandleFunc("/namespaces/", namespaceCreateHandler).Methods("POST")
+  r.HandleFunc("/namespaces/", namespaceListHandler).Methods("GET")
+  r.HandleFunc("/namespaces/{name:" + namespaceNameReString + "}/", namespaceDetailHandler).Methods("GET")
+  r.HandleFunc("/namespaces/{name:" + namespaceNameReString + "}/", namespaceUpdateHandler).Methods("PUT")
+  r.HandleFunc("/namespaces/{name:" + namespaceNameReString + "}/archive/", namespaceArchiveHandler).Methods("POST")
+  r.HandleFunc("/namespaces/{name:" + namespaceNameReString + "}/unarchive/", namespaceUnarchiveHandler).Methods("POST")
+}
@@ -0,0 +1,212 @@
+package content
+
+import (
+  "context"
+  "database/sql"
+  "fmt"
+  "regexp"
+  "strings"
+
+  "github.com/Liquid-Labs/go-api/sqldb"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/Liquid-Labs/go-rest/rest"
+)
+
+// Namespace groups content. Content slugs are unique within a namespace, and
+// a namespace is synced from at most one content source.
+type Namespace struct {
+  Name          nulls.String `json:"name"`
+  Description   nulls.String `json:"description"`
+  // OwnerPubID is the public ID of the owning entity, if any.
+  OwnerPubID    nulls.String `json:"ownerPubId"`
+  Archived      bool         `json:"archived"`
+  // URLAllowHosts, when not empty, limits URL content to the listed hosts.
+  // URLDenyHosts excludes hosts. A '*.' prefix matches any subdomain. See
+  // ValidateContentURL.
+  URLAllowHosts []string     `json:"urlAllowHosts"`
+  URLDenyHosts  []string     `json:"urlDenyHosts"`
+  // ContentCount is the number of (non-deleted) items in the namespace. It is
+  // ignored on create and update.
+  ContentCount  int64        `json:"contentCount"`
+}
+
+const namespaceNameReString = `[a-z0-9][a-z0-9_-]{0,63}`
+var namespaceNameRe *regexp.Regexp = regexp.MustCompile(`^` + namespaceNameReString + `$`)
+
+var hostPatternRe *regexp.Regexp = regexp.MustCompile(`^(\*\.)?[a-z0-9]([a-z0-9.-]*[a-z0-9])?$`)
+
+// ValidateNamespace verifies the namespace name and URL host patterns are well
+// formed. Host patterns are normalized to lower case.
+func ValidateNamespace(ns *Namespace) rest.RestError {
+  if !namespaceNameRe.MatchString(ns.Name.String) {
+    return rest.BadRequestError(fmt.Sprintf(`Invalid namespace name '%s'; must be 1-64 lowercase letters, digits, '-', or '_' and start with a letter or digit.`, ns.Name.String), nil)
+  }
+  for _, hosts := range [][]string{ns.URLAllowHosts, ns.URLDenyHosts} {
+    for i, host := range hosts {
+      hosts[i] = strings.ToLower(strings.TrimSpace(host))
+      if !hostPatternRe.MatchString(hosts[i]) {
+        return rest.BadRequestError(fmt.Sprintf(`Invalid URL host pattern '%s'.`, host), nil)
+      }
+    }
+  }
+  return nil
+}
+
+// joinHosts stores host patterns one per line.
+func joinHosts(hosts []string) nulls.String {
+  if len(hosts) == 0 {
+    return nulls.NewNullString()
+  }
+  return nulls.NewString(strings.Join(hosts, "\n"))
+}
+
+func splitHosts(hosts nulls.String) []string {
+  if hosts.IsEmpty() {
+    return make([]string, 0)
+  }
+  return strings.Split(hosts.String, "\n")
+}
+
+func scanNamespace(row interface{ Scan(...interface{}) error }) (*Namespace, error) {
+  var ns Namespace
+  var allowHosts, denyHosts nulls.String
+  if err := row.Scan(&ns.Name, &ns.Description, &ns.OwnerPubID, &ns.Archived, &allowHosts, &denyHosts, &ns.ContentCount); err != nil {
+    return nil, err
+  }
+  ns.URLAllowHosts, ns.URLDenyHosts = splitHosts(allowHosts), splitHosts(denyHosts)
+  return &ns, nil
+}
+
+// resolveNamespaceOwner returns the internal ID of the owner, or null if the
+// namespace has no owner.
+func resolveNamespaceOwner(ns *Namespace, ctx context.Context) (nulls.Int64, rest.RestError) {
+  if ns.OwnerPubID.IsEmpty() {
+    return nulls.NewNullInt64(), nil
+  }
+  ownerID, restErr := getIDByPubID(getEntityIDByPubIDStmt, `Owner`, ns.OwnerPubID.String, ctx)
+  if restErr != nil {
+    return nulls.NewNullInt64(), restErr
+  }
+  return nulls.NewInt64(ownerID), nil
+}
+
+func CreateNamespace(ns *Namespace, ctx context.Context) (*Namespace, rest.RestError) {
+  if restErr := ValidateNamespace(ns); restErr != nil {
+    return nil, restErr
+  }
+  owner, restErr := resolveNamespaceOwner(ns, ctx)
+  if restErr != nil {
+    return nil, restErr
+  }
+
+  if _, err := createNamespaceStmt.ExecContext(ctx, ns.Name, ns.Description, owner, joinHosts(ns.URLAllowHosts), joinHosts(ns.URLDenyHosts)); err != nil {
+    return nil, rest.UnprocessableEntityError(fmt.Sprintf(`Could not create namespace '%s'; possible duplicate.`, ns.Name.String), err)
+  }
+
+  return GetNamespace(ns.Name.String, ctx)
+}
+
+// GetNamespace retrieves the named Namespace. Attempting to retrieve a
+// non-existent item results in a rest.NotFoundError.
+func GetNamespace(name string, ctx context.Context) (*Namespace, rest.RestError) {
+  return getNamespaceHelper(getNamespaceStmt, ctx, nil, name)
+}
+
+func getNamespaceHelper(stmt *sql.Stmt, ctx context.Context, txn *sql.Tx, name string) (*Namespace, rest.RestError) {
+  if txn != nil {
+    stmt = txn.Stmt(stmt)
+  }
+  ns, err := scanNamespace(stmt.QueryRowContext(ctx, name))
+  if err == sql.ErrNoRows {
+    return nil, rest.NotFoundError(fmt.Sprintf(`Namespace '%s' not found.`, name), nil)
+  } else if err != nil {
+    return nil, rest.ServerError(fmt.Sprintf(`Problem getting data for namespace '%s'.`, name), err)
+  }
+  return ns, nil
+}
+
+// ListNamespaces retrieves all Namespaces ordered by name. Archived namespaces
+// are included only when requested.
+func ListNamespaces(includeArchived bool, ctx context.Context) ([]*Namespace, rest.RestError) {
+  rows, err := listNamespacesStmt.QueryContext(ctx, includeArchived)
+  if err != nil {
+    return nil, rest.ServerError(`Error retrieving namespaces.`, err)
+  }
+  defer rows.Close()
+
+  namespaces := make([]*Namespace, 0)
+  for rows.Next() {
+    ns, err := scanNamespace(rows)
+    if err != nil {
+      return nil, rest.ServerError(`Problem getting data for namespaces.`, err)
+    }
+    namespaces = append(namespaces, ns)
+  }
+
+  return namespaces, nil
+}
+
+// UpdateNamespace updates the namespace identified by 'name'. Changing the
+// Name renames the namespace; any content source for the namespace follows
+// the rename.
+func UpdateNamespace(name string, ns *Namespace, ctx context.Context) (*Namespace, rest.RestError) {
+  if restErr := ValidateNamespace(ns); restErr != nil {
+    return nil, restErr
+  }
+  owner, restErr := resolveNamespaceOwner(ns, ctx)
+  if restErr != nil {
+    return nil, restErr
+  }
+
+  txn, err := sqldb.DB.Begin()
+  if err != nil {
+    return nil, rest.ServerError(`Could not update namespace. (txn error)`, err)
+  }
+  if _, restErr := getNamespaceHelper(getNamespaceStmt, ctx, txn, name); restErr != nil {
+    defer txn.Rollback()
+    return nil, restErr
+  }
+  if _, err := txn.Stmt(updateNamespaceStmt).ExecContext(ctx, ns.Name, ns.Description, owner, joinHosts(ns.URLAllowHosts), joinHosts(ns.URLDenyHosts), name); err != nil {
+    defer txn.Rollback()
+    return nil, rest.UnprocessableEntityError(fmt.Sprintf(`Could not update namespace '%s'; possible duplicate name.`, name), err)
+  }
+  if _, err := txn.Stmt(updateContentSourceNameStmt).ExecContext(ctx, ns.Name, name); err != nil {
+    defer txn.Rollback()
+    return nil, rest.ServerError(fmt.Sprintf(`Could not update content source for namespace '%s'.`, name), err)
+  }
+  newNS, restErr := getNamespaceHelper(getNamespaceStmt, ctx, txn, ns.Name.String)
+  if restErr != nil {
+    defer txn.Rollback()
+    return nil, restErr
+  }
+  if err := txn.Commit(); err != nil {
+    return nil, rest.ServerError(`Could not update namespace. (commit error)`, err)
+  }
+
+  return newNS, nil
+}
+
+// ArchiveNamespace marks the namespace archived. The namespace content is
+// unaffected. Attempting to archive a non-existent or already archived
+// namespace results in a rest.NotFoundError.
+func ArchiveNamespace(name string, ctx context.Context) (*Namespace, rest.RestError) {
+  return execNamespaceArchiveUpdate(archiveNamespaceStmt, `archive`, name, ctx)
+}
+
+// UnarchiveNamespace reverses ArchiveNamespace.
+func UnarchiveNamespace(name string, ctx context.Context) (*Namespace, rest.RestError) {
+  return execNamespaceArchiveUpdate(unarchiveNamespaceStmt, `unarchive`, name, ctx)
+}
+
+func execNamespaceArchiveUpdate(stmt *sql.Stmt, action string, name string, ctx context.Context) (*Namespace, rest.RestError) {
+  res, err := stmt.ExecContext(ctx, name)
+  if err != nil {
+    return nil, rest.ServerError(fmt.Sprintf(`Could not %s namespace '%s'.`, action, name), err)
+  }
+  if count, err := res.RowsAffected(); err != nil {
+    return nil, rest.ServerError(fmt.Sprintf(`Could not verify %s of namespace '%s'.`, action, name), err)
+  } else if count == 0 {
+    return nil, rest.NotFoundError(fmt.Sprintf(`No namespace '%s' to %s.`, name, action), nil)
+  }
+  return GetNamespace(name, ctx)
+}
@@ -0,0 +1,96 @@
+package content
+
+// Queries for tables owned by the content API. Queries against the core content
+// tables are defined in catalyst-content-model.
+
+const getContentIDByPubIDQuery = `SELECT c.id FROM content_summary c JOIN entities e ON c.id=e.id WHERE e.pub_id=?`
+const getEntityIDByPubIDQuery = `SELECT id FROM entities WHERE pub_id=?`
+
+const contextContentInsertQuery = `INSERT IGNORE INTO content_contexts (content, context, context_type) VALUES(?,?,?)`
+const contextContentDeleteQuery = `DELETE cx FROM content_contexts cx JOIN entities ce ON cx.context=ce.id JOIN entities e ON cx.content=e.id WHERE ce.pub_id=? AND cx.context_type=? AND e.pub_id=?`
+
+const contentIsDeletedQuery = `SELECT c.deleted_at IS NOT NULL FROM content_summary c JOIN entities e ON c.id=e.id WHERE e.pub_id=?`
+const contentSoftDeleteQuery = `UPDATE content_summary c JOIN entities e ON c.id=e.id SET c.deleted_at=NOW() WHERE e.pub_id=? AND c.deleted_at IS NULL`
+const contentRestoreQuery = `UPDATE content_summary c JOIN entities e ON c.id=e.id SET c.deleted_at=NULL WHERE e.pub_id=? AND c.deleted_at IS NOT NULL`
+const contentPurgeContributorsQuery = `DELETE FROM contributors WHERE content=?`
+const contentPurgeTypeTextQuery = `DELETE FROM content_type_text WHERE id=?`
+const contentPurgeSummaryQuery = `DELETE FROM content_summary WHERE id=?`
+const contentPurgeEntityQuery = `DELETE FROM entities WHERE id=?`
+
+const contentSourceSelect = `SELECT e.id, e.pub_id, e.last_updated, s.source_type, s.name, cfg.config_key, cfg.config_value FROM content_sources s JOIN entities e ON s.id=e.id LEFT JOIN content_source_config cfg ON cfg.source=s.id `
+const getContentSourceQuery = contentSourceSelect + `WHERE e.pub_id=?`
+const getContentSourceByNameQuery = contentSourceSelect + `WHERE s.name=?`
+const getContentSourceByIDQuery = contentSourceSelect + `WHERE e.id=?`
+
+const getContentRefQuery = `SELECT e.pub_id, c.type FROM content_summary c JOIN entities e ON c.id=e.id WHERE e.pub_id=? AND c.deleted_at IS NULL`
+const getContentRefByNSSlugQuery = `SELECT e.pub_id, c.type FROM content_summary c JOIN entities e ON c.id=e.id JOIN namespace ns ON c.namespace=ns.id WHERE ns.name=? AND c.slug=? AND c.deleted_at IS NULL`
+
+const createContentTypeAssetQuery = `INSERT INTO content_type_asset (id) VALUES(?)`
+const contentTypeAssetSelect = `SELECT e.pub_id, e.last_updated, c.title, c.summary, ns.name, c.source_type, c.slug, c.type, ` +
+  `a.mime_type, a.size, a.checksum, a.blob_key, pe.pub_id, p.display_name, cc.role, cc.summary_credit_order ` +
+  `FROM content_summary c JOIN content_type_asset a ON c.id=a.id JOIN entities e ON c.id=e.id JOIN namespace ns ON c.namespace=ns.id ` +
+  `LEFT JOIN contributors cc ON cc.content=c.id LEFT JOIN persons p ON cc.person=p.id LEFT JOIN entities pe ON p.id=pe.id `
+const getContentTypeAssetQuery = contentTypeAssetSelect + `WHERE e.pub_id=? AND c.deleted_at IS NULL ORDER BY cc.summary_credit_order`
+const getContentTypeAssetByIDQuery = contentTypeAssetSelect + `WHERE e.id=? AND c.deleted_at IS NULL ORDER BY cc.summary_credit_order`
+const updateContentSummaryQuery = `UPDATE content_summary c JOIN entities e ON c.id=e.id SET c.title=?, c.summary=?, c.slug=? WHERE e.pub_id=? AND c.deleted_at IS NULL`
+const lockContentTypeAssetBlobKeyQuery = `SELECT a.blob_key FROM content_type_asset a JOIN content_summary c ON a.id=c.id JOIN entities e ON a.id=e.id WHERE e.pub_id=? AND c.deleted_at IS NULL FOR UPDATE`
+const updateContentTypeAssetDataQuery = `UPDATE content_type_asset a JOIN entities e ON a.id=e.id SET a.mime_type=?, a.size=?, a.checksum=?, a.blob_key=? WHERE e.pub_id=?`
+const getContentTypeAssetBlobKeyByIDQuery = `SELECT blob_key FROM content_type_asset WHERE id=?`
+const contentPurgeTypeAssetQuery = `DELETE FROM content_type_asset WHERE id=?`
+
+const listContentSourcesQuery = contentSourceSelect + `ORDER BY s.name, cfg.config_key`
+const createContentSourceQuery = `INSERT INTO content_sources (id, source_type, name) VALUES(?,?,?)`
+const updateContentSourceQuery = `UPDATE content_sources s JOIN entities e ON s.id=e.id SET s.source_type=?, s.name=? WHERE e.pub_id=?`
+const contentSourceConfigDeleteQuery = `DELETE FROM content_source_config WHERE source=?`
+const contentSourceConfigInsertQuery = `INSERT INTO content_source_config (source, config_key, config_value) VALUES(?,?,?)`
+const listContentSourceConfigQuery = `SELECT config_key, config_value FROM content_source_config WHERE source=?`
+const listAllContentSourceConfigQuery = `SELECT cfg.source, s.source_type, cfg.config_key, cfg.config_value FROM content_source_config cfg JOIN content_sources s ON cfg.source=s.id`
+const rewrapContentSourceSecretQuery = `UPDATE content_source_config SET config_value=? WHERE source=? AND config_key=? AND config_value=?`
+const deleteContentSourceQuery = `DELETE e FROM entities e JOIN content_sources s ON s.id=e.id WHERE e.pub_id=?`
+const getNamespaceIDByNameQuery = `SELECT id FROM namespace WHERE name=?`
+
+const namespaceSelect = `SELECT ns.name, ns.description, oe.pub_id, ns.archived_at IS NOT NULL, ns.url_allow_hosts, ns.url_deny_hosts, ` +
+  `(SELECT COUNT(*) FROM content_summary c WHERE c.namespace=ns.id AND c.deleted_at IS NULL) ` +
+  `FROM namespace ns LEFT JOIN entities oe ON ns.owner=oe.id `
+const getNamespaceQuery = namespaceSelect + `WHERE ns.name=?`
+const listNamespacesQuery = namespaceSelect + `WHERE ns.archived_at IS NULL OR ? ORDER BY ns.name`
+const createNamespaceQuery = `INSERT INTO namespace (name, description, owner, url_allow_hosts, url_deny_hosts) VALUES(?,?,?,?,?)`
+const updateNamespaceQuery = `UPDATE namespace SET name=?, description=?, owner=?, url_allow_hosts=?, url_deny_hosts=? WHERE name=?`
+const updateContentSourceNameQuery = `UPDATE content_sources SET name=? WHERE name=?`
+const archiveNamespaceQuery = `UPDATE namespace SET archived_at=NOW() WHERE name=? AND archived_at IS NULL`
+const unarchiveNamespaceQuery = `UPDATE namespace SET archived_at=NULL WHERE name=? AND archived_at IS NOT NULL`
+
+const lockContentForRevisionQuery = `SELECT c.id FROM content_summary c JOIN entities e ON c.id=e.id WHERE e.pub_id=? FOR UPDATE`
+const createContentRevisionQuery = `INSERT INTO content_revisions (content, revision, author, source, title, summary, slug, extern_path, version_cookie, format, text) ` +
+  `SELECT ?, COALESCE(MAX(r.revision), 0) + 1, ?, ?, ?, ?, ?, ?, ?, ?, ? FROM content_revisions r WHERE r.content=?`
+const carryContentRevisionQuery = `INSERT INTO content_revisions (content, revision, author, source, title, summary, slug, extern_path, version_cookie, format, text) ` +
+  `SELECT c.id, COALESCE(r.revision, 0) + 1, ?, ?, c.title, c.summary, c.slug, c.extern_path, c.version_cookie, r.format, r.text ` +
+  `FROM content_summary c LEFT JOIN content_revisions r ON r.content=c.id AND r.revision=(SELECT MAX(lr.revision) FROM content_revisions lr WHERE lr.content=c.id) ` +
+  `WHERE c.id=?`
+const contentRevisionSelect = `SELECT r.revision, r.author, r.source, UNIX_TIMESTAMP(r.created_at), r.title, r.summary, r.slug, r.extern_path, r.version_cookie, r.format, r.text ` +
+  `FROM content_revisions r JOIN entities e ON r.content=e.id `
+const listContentRevisionsQuery = contentRevisionSelect + `WHERE e.pub_id=? ORDER BY r.revision DESC`
+const getContentRevisionQuery = contentRevisionSelect + `WHERE e.pub_id=? AND r.revision=?`
+
+const contentRevisionNumberSelect = `SELECT (SELECT COALESCE(MAX(r.revision), 0) FROM content_revisions r WHERE r.content=c.id) ` +
+  `FROM content_summary c JOIN entities e ON c.id=e.id WHERE e.pub_id=? AND c.deleted_at IS NULL`
+const getContentRevisionNumberQuery = contentRevisionNumberSelect
+const lockContentVersionQuery = contentRevisionNumberSelect + ` FOR UPDATE`
+
+const syncedContentSelect = `SELECT c.id, e.pub_id, c.extern_path, c.version_cookie, c.slug, c.deleted_at IS NOT NULL ` +
+  `FROM content_summary c JOIN entities e ON c.id=e.id JOIN namespace ns ON c.namespace=ns.id `
+const listSyncedContentQuery = syncedContentSelect + `WHERE ns.name=? AND c.source_type=?`
+const listNamespaceContentQuery = syncedContentSelect + `WHERE ns.name=? AND c.deleted_at IS NULL`
+const updateSyncedTextQuery = `UPDATE content_summary c JOIN content_type_text t ON c.id=t.id JOIN entities e ON c.id=e.id ` +
+  `SET t.text=?, c.version_cookie=? WHERE e.pub_id=?`
+
+const listURLContentQuery = `SELECT e.pub_id FROM content_summary c JOIN content_type_text t ON c.id=t.id JOIN entities e ON c.id=e.id ` +
+  `WHERE c.source_type='URL' AND c.deleted_at IS NULL ORDER BY c.id`
+
+const createSyncRunQuery = `INSERT INTO content_sync_runs (source, trigger_type, status) SELECT s.id, ?, ? FROM content_sources s JOIN entities e ON s.id=e.id WHERE e.pub_id=?`
+const failInterruptedSyncRunsQuery = `UPDATE content_sync_runs SET status=?, finished_at=CURRENT_TIMESTAMP, message=? WHERE status=?`
+const getLastSyncRunQuery = `SELECT r.status, r.version FROM content_sync_runs r JOIN entities e ON r.source=e.id WHERE e.pub_id=? AND r.status<>? ORDER BY r.id DESC LIMIT 1`
+const finishSyncRunQuery = `UPDATE content_sync_runs SET status=?, version=?, finished_at=CURRENT_TIMESTAMP, created_count=?, updated_count=?, deleted_count=?, failed_count=?, failures=?, message=? WHERE id=?`
+const listSyncRunsQuery = `SELECT r.id, r.trigger_type, r.status, r.version, UNIX_TIMESTAMP(r.started_at), UNIX_TIMESTAMP(r.finished_at), ` +
+  `r.created_count, r.updated_count, r.deleted_count, r.failed_count, r.failures, r.message ` +
+  `FROM content_sync_runs r JOIN entities e ON r.source=e.id WHERE e.pub_id=? ORDER BY r.id DESC LIMIT ?`
@@ -0,0 +1,70 @@
+package content
+
+import (
+  "bytes"
+  "fmt"
+  "html"
+  "regexp"
+
+  "github.com/microcosm-cc/bluemonday"
+  "github.com/yuin/goldmark"
+  "github.com/yuin/goldmark/extension"
+
+  "github.com/Liquid-Labs/go-rest/rest"
+
+  model "github.com/Liquid-Labs/catalyst-content-model/go/resources/content"
+)
+
+// htmlPolicy sanitizes rendered HTML: scripts, event handlers, styles, and
+// 'javascript:' URLs are removed, leaving the usual user-generated content
+// markup. The disabled checkboxes of GFM task lists and table cell alignment
+// are kept.
+var htmlPolicy *bluemonday.Policy = newHTMLPolicy()
+
+func newHTMLPolicy() *bluemonday.Policy {
+  policy := bluemonday.UGCPolicy()
+  policy.AllowAttrs(`type`).Matching(regexp.MustCompile(`^checkbox$`)).OnElements(`input`)
+  policy.AllowAttrs(`checked`, `disabled`).Matching(regexp.MustCompile(`^(|checked|disabled)$`)).OnElements(`input`)
+  policy.AllowStyles(`text-align`).MatchingEnum(`left`, `right`, `center`).OnElements(`th`, `td`)
+  return policy
+}
+
+// markdown renders CommonMark with the GitHub Flavored Markdown extensions
+// (tables, task lists, strikethrough, and autolinks). Raw HTML in the source is
+// omitted from the output.
+var markdown goldmark.Markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// RenderedContentTypeText is a model.ContentTypeText bundled with the HTML
+// rendering of its text.
+type RenderedContentTypeText struct {
+  model.ContentTypeText
+  Rendered string `json:"rendered"`
+}
+
+// RenderContentTypeText renders the text to HTML according to the content
+// Format. 'MARKDOWN' is rendered as GFM, 'HTML' is passed through, and 'TEXT'
+// is escaped and preformatted. Rendered Markdown and HTML are sanitized with
+// htmlPolicy, so the result is safe to embed in a page.
+func RenderContentTypeText(c *model.ContentTypeText) (*RenderedContentTypeText, rest.RestError) {
+  rendered := &RenderedContentTypeText{ ContentTypeText: *c }
+  if !c.Text.IsValid() {
+    return rendered, nil
+  }
+
+  switch c.Format.String {
+  case `MARKDOWN`:
+    var buf bytes.Buffer
+    if err := markdown.Convert([]byte(c.Text.String), &buf); err != nil {
+      return nil, rest.ServerError(fmt.Sprintf(`Could not render content '%s'.`, c.PubId.String), err)
+    }
+    rendered.Rendered = htmlPolicy.Sanitize(buf.String())
+  case `HTML`:
+    rendered.Rendered = htmlPolicy.Sanitize(c.Text.String)
+  case `TEXT`:
+    rendered.Rendered = `<pre>` + html.EscapeString(c.Text.String) + `</pre>`
+  default:
+    return nil, rest.UnprocessableEntityError(fmt.Sprintf(`Cannot render content format '%s'.`, c.Format.String), nil)
+  }
+
+  return rendered, nil
+}
@@ -0,0 +1,82 @@
+package content
+
+import (
+  "strings"
+  "testing"
+
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+
+  model "github.com/Liquid-Labs/catalyst-content-model/go/resources/content"
+)
+
+func renderTest(t *testing.T, format string, text string) string {
+  t.Helper()
+  c := &model.ContentTypeText{}
+  c.Format = nulls.NewString(format)
+  c.Text = nulls.NewString(text)
+  rendered, restErr := RenderContentTypeText(c)
+  if restErr != nil {
+    t.Fatalf(`could not render: %v`, restErr)
+  }
+  return rendered.Rendered
+}
+
+func TestRenderMarkdown(t *testing.T) {
+  for _, check := range []struct {
+    description string
+    text        string
+    expected    []string
+    unexpected  []string
+  }{
+    {
+      `task list`,
+      "- [x] done\n- [ ] todo\n",
+      []string{`<input checked="" disabled="" type="checkbox"`, `<input disabled="" type="checkbox"`},
+      nil,
+    },
+    {
+      `table alignment`,
+      "| left | center | right |\n|:-----|:------:|------:|\n| a | b | c |\n",
+      []string{`<th style="text-align: left">`, `<th style="text-align: center">`, `<td style="text-align: right">`},
+      nil,
+    },
+    {
+      `strikethrough and autolink`,
+      "~~gone~~ see https://example.com\n",
+      []string{`<del>gone</del>`, `<a href="https://example.com" rel="nofollow">`},
+      nil,
+    },
+    {
+      `script`,
+      "<script>alert(1)</script>\n\n[x](javascript:alert(1))\n",
+      nil,
+      []string{`<script`, `javascript:`},
+    },
+  } {
+    rendered := renderTest(t, `MARKDOWN`, check.text)
+    for _, expected := range check.expected {
+      if !strings.Contains(rendered, expected) {
+        t.Errorf(`%s: '%s' does not contain '%s'`, check.description, rendered, expected)
+      }
+    }
+    for _, unexpected := range check.unexpected {
+      if strings.Contains(rendered, unexpected) {
+        t.Errorf(`%s: '%s' contains '%s'`, check.description, rendered, unexpected)
+      }
+    }
+  }
+}
+
+func TestRenderHTMLRestrictsInputsAndStyles(t *testing.T) {
+  rendered := renderTest(t, `HTML`,
+    `<input type="text" value="x"><input type="checkbox" onclick="x()">` +
+    `<td style="text-align: left; position: fixed">a</td><p style="text-align: left">b</p>`)
+  for _, unexpected := range []string{`type="text"`, `onclick`, `position`, `<p style`} {
+    if strings.Contains(rendered, unexpected) {
+      t.Errorf(`'%s' contains '%s'`, rendered, unexpected)
+    }
+  }
+  if !strings.Contains(rendered, `type="checkbox"`) {
+    t.Errorf(`'%s' does not keep the checkbox`, rendered)
+  }
+}
@@ -0,0 +1,177 @@
+package content
+
+import (
+  "context"
+  "database/sql"
+  "fmt"
+
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/Liquid-Labs/go-rest/rest"
+
+  model "github.com/Liquid-Labs/catalyst-content-model/go/resources/content"
+)
+
+// Revision sources.
+const (
+  RevisionSourceUser = `USER`
+  RevisionSourceSync = `SYNC`
+)
+
+type revisionContextKey int
+
+const (
+  revisionAuthorKey revisionContextKey = iota
+  revisionSourceKey
+)
+
+// WithRevisionAuthor returns a context which attributes any revisions recorded
+// under it to 'author'.
+func WithRevisionAuthor(ctx context.Context, author string) context.Context {
+  return context.WithValue(ctx, revisionAuthorKey, author)
+}
+
+// WithRevisionSource returns a context which marks any revisions recorded
+// under it as coming from 'source'. Revisions default to RevisionSourceUser.
+func WithRevisionSource(ctx context.Context, source string) context.Context {
+  return context.WithValue(ctx, revisionSourceKey, source)
+}
+
+func revisionAuthor(ctx context.Context) nulls.String {
+  if author, ok := ctx.Value(revisionAuthorKey).(string); ok && author != `` {
+    return nulls.NewString(author)
+  }
+  return nulls.NewNullString()
+}
+
+func revisionSource(ctx context.Context) string {
+  if source, ok := ctx.Value(revisionSourceKey).(string); ok {
+    return source
+  }
+  return RevisionSourceUser
+}
+
+// ContentRevision is an immutable snapshot of a model.ContentTypeText or
+// ContentTypeAsset taken when the content is created or updated. Asset
+// revisions have no Format or Text; the VersionCookie holds the data checksum.
+type ContentRevision struct {
+  Revision      int64        `json:"revision"`
+  Author        nulls.String `json:"author"`
+  Source        string       `json:"source"`
+  // CreatedAt is the revision time in seconds since the epoch.
+  CreatedAt     int64        `json:"createdAt"`
+  Title         nulls.String `json:"title"`
+  Summary       nulls.String `json:"summary"`
+  Slug          nulls.String `json:"slug"`
+  ExternPath    nulls.String `json:"externPath"`
+  VersionCookie nulls.String `json:"versionCookie"`
+  Format        nulls.String `json:"format"`
+  Text          nulls.String `json:"text,omitempty"`
+}
+
+// recordContentRevisionInTxn snapshots the current state of the content. The
+// author and source are taken from the context. See WithRevisionAuthor and
+// WithRevisionSource.
+//
+// The content row is locked before the next revision number is determined so
+// that concurrent updates are numbered in turn rather than colliding.
+func recordContentRevisionInTxn(c *model.ContentTypeText, ctx context.Context, txn *sql.Tx) rest.RestError {
+  var id int64
+  if err := txn.Stmt(lockContentForRevisionStmt).QueryRowContext(ctx, c.PubId).Scan(&id); err != nil {
+    defer txn.Rollback()
+    return rest.ServerError(fmt.Sprintf(`Could not lock content '%s' to record revision.`, c.PubId.String), err)
+  }
+  if _, err := txn.Stmt(createContentRevisionStmt).ExecContext(ctx,
+      id, revisionAuthor(ctx), revisionSource(ctx),
+      c.Title, c.Summary, c.Slug, c.ExternPath, c.VersionCookie, c.Format, c.Text,
+      id); err != nil {
+    defer txn.Rollback()
+    return rest.ServerError(fmt.Sprintf(`Could not record revision for content '%s'.`, c.PubId.String), err)
+  }
+  return nil
+}
+
+// recordContentChangeInTxn records a revision for a change outside of the
+// snapshot, such as to the contributors or the deleted state, so that the
+// revision number, and with it the ETag, moves on. The revision carries forward
+// the current summary and the format and text of the latest revision.
+func recordContentChangeInTxn(pubID string, ctx context.Context, txn *sql.Tx) rest.RestError {
+  var id int64
+  if err := txn.Stmt(lockContentForRevisionStmt).QueryRowContext(ctx, pubID).Scan(&id); err != nil {
+    defer txn.Rollback()
+    return rest.ServerError(fmt.Sprintf(`Could not lock content '%s' to record revision.`, pubID), err)
+  }
+  if _, err := txn.Stmt(carryContentRevisionStmt).ExecContext(ctx, revisionAuthor(ctx), revisionSource(ctx), id); err != nil {
+    defer txn.Rollback()
+    return rest.ServerError(fmt.Sprintf(`Could not record revision for content '%s'.`, pubID), err)
+  }
+  return nil
+}
+
+// recordAssetRevisionInTxn snapshots the current state of the asset. See
+// recordContentRevisionInTxn.
+func recordAssetRevisionInTxn(c *ContentTypeAsset, ctx context.Context, txn *sql.Tx) rest.RestError {
+  snapshot := &model.ContentTypeText{ ContentSummary: c.ContentSummary }
+  snapshot.VersionCookie = c.Checksum
+  return recordContentRevisionInTxn(snapshot, ctx, txn)
+}
+
+// ListContentRevisions retrieves the revisions for the content, newest first.
+// The revision text is omitted; use GetContentRevision to retrieve the full
+// snapshot.
+func ListContentRevisions(pubID string, ctx context.Context) ([]*ContentRevision, rest.RestError) {
+  if _, restErr := GetContentRef(pubID, ctx); restErr != nil {
+    return nil, restErr
+  }
+
+  rows, err := listContentRevisionsStmt.QueryContext(ctx, pubID)
+  if err != nil {
+    return nil, rest.ServerError(fmt.Sprintf(`Error retrieving revisions for content '%s'.`, pubID), err)
+  }
+  defer rows.Close()
+
+  revisions := make([]*ContentRevision, 0)
+  for rows.Next() {
+    revision, err := scanContentRevision(rows)
+    if err != nil {
+      return nil, rest.ServerError(fmt.Sprintf(`Problem getting revision data for content '%s'.`, pubID), err)
+    }
+    revision.Text = nulls.NewNullString()
+    revisions = append(revisions, revision)
+  }
+
+  return revisions, nil
+}
+
+// GetContentRevision retrieves the numbered revision of the content.
+// Attempting to retrieve a non-existent revision results in a
+// rest.NotFoundError.
+func GetContentRevision(pubID string, revision int64, ctx context.Context) (*ContentRevision, rest.RestError) {
+  if _, restErr := GetContentRef(pubID, ctx); restErr != nil {
+    return nil, restErr
+  }
+
+  rows, err := getContentRevisionStmt.QueryContext(ctx, pubID, revision)
+  if err != nil {
+    return nil, rest.ServerError(fmt.Sprintf(`Error retrieving revision %d for content '%s'.`, revision, pubID), err)
+  }
+  defer rows.Close()
+
+  if !rows.Next() {
+    return nil, rest.NotFoundError(fmt.Sprintf(`Revision %d for content '%s' not found.`, revision, pubID), nil)
+  }
+  result, err := scanContentRevision(rows)
+  if err != nil {
+    return nil, rest.ServerError(fmt.Sprintf(`Problem getting revision %d data for content '%s'.`, revision, pubID), err)
+  }
+
+  return result, nil
+}
+
+func scanContentRevision(rows *sql.Rows) (*ContentRevision, error) {
+  var r ContentRevision
+  if err := rows.Scan(&r.Revision, &r.Author, &r.Source, &r.CreatedAt, &r.Title, &r.Summary, &r.Slug,
+      &r.ExternPath, &r.VersionCookie, &r.Format, &r.Text); err != nil {
+    return nil, err
+  }
+  return &r, nil
+}
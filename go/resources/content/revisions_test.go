@@ -0,0 +1,42 @@
+package content
+
+import (
+  "context"
+  "database/sql/driver"
+  "reflect"
+  "testing"
+)
+
+func TestTombstoneUpdatesRecordRevision(t *testing.T) {
+  const pubID = `7c0b3f57-2f4d-4f3e-8d52-3d1f1f3c9a40`
+  var authors []interface{}
+  defer useFakeDB(t, map[string]fakeQueryHandler{
+    contentSoftDeleteQuery      : fakeExec,
+    contentRestoreQuery         : fakeExec,
+    lockContentForRevisionQuery : func(args []driver.Value) ([]string, [][]driver.Value, error) {
+      return fakeColumns(1), [][]driver.Value{{int64(3)}}, nil
+    },
+    carryContentRevisionQuery   : func(args []driver.Value) ([]string, [][]driver.Value, error) {
+      authors = append(authors, args[0])
+      return nil, nil, nil
+    },
+  })()
+  ctx := WithRevisionAuthor(context.Background(), `author-1`)
+
+  if restErr := DeleteContent(pubID, ctx); restErr != nil {
+    t.Fatalf(`could not delete: %v`, restErr)
+  }
+  if restErr := RestoreContent(pubID, ctx); restErr != nil {
+    t.Fatalf(`could not restore: %v`, restErr)
+  }
+  expected := []string{
+    contentSoftDeleteQuery, lockContentForRevisionQuery, carryContentRevisionQuery,
+    contentRestoreQuery, lockContentForRevisionQuery, carryContentRevisionQuery,
+  }
+  if executed := fakeDBExecuted(); !reflect.DeepEqual(executed, expected) {
+    t.Errorf(`executed %v; expected %v`, executed, expected)
+  }
+  if !reflect.DeepEqual(authors, []interface{}{`author-1`, `author-1`}) {
+    t.Errorf(`revisions attributed to %v`, authors)
+  }
+}
@@ -0,0 +1,123 @@
+package content
+
+import (
+  "fmt"
+  "strings"
+  "unicode"
+)
+
+// Content is searched with MySQL full-text boolean queries over the title and
+// summary (weighted by searchTitleWeight) and the text, and by contributor
+// name. The search supports the boolean mode syntax; e.g., '+required
+// -excluded', '"exact phrase"', 'prefix*', and '(grouped terms)'. A search
+// which is not a valid boolean query, such as 'C++' or an email address, is
+// searched as a phrase. Note that words shorter than the server's minimum token
+// size ('innodb_ft_min_token_size', 3 by default) and stopwords are not
+// indexed.
+const searchTitleWeight = 2
+
+const searchTitleSummaryMatch = `MATCH(c.title, c.summary) AGAINST(? IN BOOLEAN MODE)`
+const searchTextMatch = `MATCH(t.text) AGAINST(? IN BOOLEAN MODE)`
+
+// The full-text matches are made in subqueries against the indexed tables so
+// that each can use its index; a 'MATCH' on an outer-joined table cannot.
+const searchTitleSummaryIDs = `SELECT id FROM content_summary WHERE MATCH(title, summary) AGAINST(? IN BOOLEAN MODE)`
+const searchTextIDs = `SELECT id FROM content_type_text WHERE MATCH(text) AGAINST(? IN BOOLEAN MODE)`
+
+// searchQuery converts the search to a full-text boolean query. A search which
+// is not a valid query is quoted as a phrase. Returns '' if the search has no
+// words to match.
+func searchQuery(search string) string {
+  if !hasSearchWord(search) {
+    return ``
+  }
+  if validateSearch(search) == nil {
+    return search
+  }
+  // Boolean mode has no escape for '"' within a phrase.
+  return `"` + strings.Join(strings.Fields(strings.Replace(search, `"`, ` `, -1)), ` `) + `"`
+}
+
+// contentSearchWhere builds the 'WHERE' bit matching the search against the
+// full-text indexes and contributor names.
+func contentSearchWhere(search string) (string, []interface{}) {
+  likeTerm := `%` + search + `%`
+  query := searchQuery(search)
+  if query == `` {
+    return `AND p.display_name LIKE ? `, []interface{}{likeTerm}
+  }
+  return `AND (c.id IN (` + searchTitleSummaryIDs + `) OR c.id IN (` + searchTextIDs + `) OR p.display_name LIKE ?) `,
+    []interface{}{query, query, likeTerm}
+}
+
+// contentRelevance builds the relevance score expression for the search and
+// its parameters. Without a search, all content is equally relevant.
+func contentRelevance(search string) (string, []interface{}) {
+  query := searchQuery(search)
+  if query == `` {
+    return `0`, nil
+  }
+  return fmt.Sprintf(`MAX(%d * %s + %s)`, searchTitleWeight, searchTitleSummaryMatch, searchTextMatch),
+    []interface{}{query, query}
+}
+
+// validateSearch rejects boolean queries MySQL would fail to parse: unbalanced
+// quotes or parentheses, dangling operators, and the unsupported '@' distance
+// operator.
+func validateSearch(search string) error {
+  runes := []rune(search)
+  depth := 0
+  inQuote := false
+  for i, r := range runes {
+    if r == '"' {
+      inQuote = !inQuote
+      continue
+    }
+    if inQuote {
+      continue
+    }
+    switch r {
+    case '(':
+      depth++
+    case ')':
+      if depth == 0 {
+        return fmt.Errorf(`unbalanced ')' in search`)
+      }
+      depth--
+    case '@':
+      return fmt.Errorf(`the '@' operator is not supported in search`)
+    case '+', '-', '~', '<', '>':
+      if i > 0 && !unicode.IsSpace(runes[i - 1]) && runes[i - 1] != '(' {
+        if r == '-' { // hyphenated words are searched as separate words
+          continue
+        }
+        return fmt.Errorf(`operator '%c' must begin a word in search`, r)
+      }
+      if i + 1 == len(runes) || !(isSearchWordRune(runes[i + 1]) || runes[i + 1] == '"' || runes[i + 1] == '(') {
+        return fmt.Errorf(`operator '%c' must be followed by a word, phrase, or group in search`, r)
+      }
+    case '*':
+      if i == 0 || !isSearchWordRune(runes[i - 1]) {
+        return fmt.Errorf(`'*' must follow a word in search`)
+      }
+    }
+  }
+  if inQuote {
+    return fmt.Errorf(`unclosed '"' in search`)
+  }
+  if depth != 0 {
+    return fmt.Errorf(`unbalanced '(' in search`)
+  }
+  if !hasSearchWord(search) {
+    return fmt.Errorf(`search must include at least one word`)
+  }
+  return nil
+}
+
+func hasSearchWord(search string) bool {
+  return strings.IndexFunc(search, isSearchWordRune) >= 0
+}
+
+func isSearchWordRune(r rune) bool {
+  return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '\''
+}
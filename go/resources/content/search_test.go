@@ -0,0 +1,81 @@
+package content
+
+import (
+  "reflect"
+  "strings"
+  "testing"
+)
+
+func TestValidateSearch(t *testing.T) {
+  for _, check := range []struct {
+    search string
+    valid  bool
+  }{
+    { `markdown`, true },
+    { `+required -excluded`, true },
+    { `"exact phrase"`, true },
+    { `prefix*`, true },
+    { `+(grouped terms) ~lower`, true },
+    { `well-known`, true },
+    { `don't`, true },
+    { `C++`, false },
+    { `someone@example.com`, false },
+    { `"unclosed`, false },
+    { `(unbalanced`, false },
+    { `unbalanced)`, false },
+    { `dangling +`, false },
+    { `*star`, false },
+    { `+++`, false },
+  } {
+    err := validateSearch(check.search)
+    if valid := err == nil; valid != check.valid {
+      t.Errorf(`validateSearch('%s') valid: %t; expected %t (%v)`, check.search, valid, check.valid, err)
+    }
+  }
+}
+
+func TestSearchQuery(t *testing.T) {
+  for _, check := range []struct {
+    search   string
+    expected string
+  }{
+    { `+required -excluded`, `+required -excluded` },
+    { `"exact phrase"`, `"exact phrase"` },
+    { `C++`, `"C++"` },
+    { `someone@example.com`, `"someone@example.com"` },
+    { `say "hi`, `"say hi"` },
+    { `  (spaced   out  `, `"(spaced out"` },
+    { `+++`, `` },
+    { `   `, `` },
+  } {
+    if actual := searchQuery(check.search); actual != check.expected {
+      t.Errorf(`searchQuery('%s') is '%s'; expected '%s'`, check.search, actual, check.expected)
+    }
+  }
+}
+
+func TestContentSearchWhere(t *testing.T) {
+  for _, check := range []struct {
+    search   string
+    fullText bool
+    params   []interface{}
+  }{
+    { `markdown`, true, []interface{}{`markdown`, `markdown`, `%markdown%`} },
+    { `C++`, true, []interface{}{`"C++"`, `"C++"`, `%C++%`} },
+    { `+++`, false, []interface{}{`%+++%`} },
+  } {
+    whereBit, params := contentSearchWhere(check.search)
+    if fullText := strings.Contains(whereBit, `MATCH`); fullText != check.fullText {
+      t.Errorf(`search '%s' full-text: %t; expected %t`, check.search, fullText, check.fullText)
+    }
+    if !strings.Contains(whereBit, `p.display_name LIKE ?`) {
+      t.Errorf(`search '%s' does not match contributor names: %s`, check.search, whereBit)
+    }
+    if strings.Count(whereBit, `?`) != len(params) {
+      t.Errorf(`search '%s' has %d placeholders for %d params`, check.search, strings.Count(whereBit, `?`), len(params))
+    }
+    if !reflect.DeepEqual(params, check.params) {
+      t.Errorf(`search '%s' params are %v; expected %v`, check.search, params, check.params)
+    }
+  }
+}
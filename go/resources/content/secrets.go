@@ -0,0 +1,351 @@
+package content
+
+import (
+  "context"
+  "crypto/aes"
+  "crypto/cipher"
+  "crypto/rand"
+  "database/sql"
+  "encoding/base64"
+  "fmt"
+  "io"
+  "log"
+  "regexp"
+  "strings"
+
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/Liquid-Labs/go-rest/rest"
+
+  model "github.com/Liquid-Labs/catalyst-content-model/go/resources/content"
+)
+
+// RedactedSecret replaces secret configuration values in content sources
+// retrieved from the database. Updating a source with the redacted value
+// keeps the stored secret.
+const RedactedSecret = `**REDACTED**`
+
+// Stored secrets have the form 'enc:<key ID>:<base64 nonce and ciphertext>'.
+// Values without the prefix were stored before encryption was introduced and
+// are read as plain text until re-encrypted; see RewrapContentSourceSecrets.
+const encryptedSecretPrefix = `enc:`
+
+type secretKey struct {
+  id   string
+  aead cipher.AEAD
+}
+
+// secretKeys holds the configured keys; the first encrypts new secrets and
+// all may decrypt.
+var secretKeys []*secretKey
+
+var secretKeyIDRe *regexp.Regexp = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// SetSecretKeys configures the content source secret keys from a comma
+// separated list of '<key ID>:<base64 key>' entries. Keys must be 32 bytes
+// (AES-256). The first key is used to encrypt; the rest are retained to
+// decrypt secrets stored under earlier keys. To rotate, prepend a new key,
+// run RewrapContentSourceSecrets, then drop the old key.
+func SetSecretKeys(spec string) error {
+  keys := make([]*secretKey, 0)
+  seen := make(map[string]bool)
+  for _, entry := range strings.Split(spec, `,`) {
+    entry = strings.TrimSpace(entry)
+    if entry == `` {
+      continue
+    }
+    parts := strings.SplitN(entry, `:`, 2)
+    if len(parts) != 2 || !secretKeyIDRe.MatchString(parts[0]) {
+      return fmt.Errorf(`invalid secret key entry; expected '<key ID>:<base64 key>'`)
+    }
+    if seen[parts[0]] {
+      return fmt.Errorf(`duplicate secret key ID '%s'`, parts[0])
+    }
+    seen[parts[0]] = true
+    raw, err := base64.StdEncoding.DecodeString(parts[1])
+    if err != nil {
+      return fmt.Errorf(`invalid secret key '%s': %v`, parts[0], err)
+    }
+    if len(raw) != 32 {
+      return fmt.Errorf(`secret key '%s' must be 32 bytes; got %d`, parts[0], len(raw))
+    }
+    block, err := aes.NewCipher(raw)
+    if err != nil {
+      return fmt.Errorf(`invalid secret key '%s': %v`, parts[0], err)
+    }
+    aead, err := cipher.NewGCM(block)
+    if err != nil {
+      return fmt.Errorf(`invalid secret key '%s': %v`, parts[0], err)
+    }
+    keys = append(keys, &secretKey{ id: parts[0], aead: aead })
+  }
+  if len(keys) == 0 {
+    return fmt.Errorf(`no secret keys given`)
+  }
+  secretKeys = keys
+  return nil
+}
+
+// isSecretConfig determines whether the configuration key holds a secret for
+// the source type.
+func isSecretConfig(sourceType string, key string) bool {
+  for _, secret := range contentSourceTypes[sourceType].Secret {
+    if secret == key {
+      return true
+    }
+  }
+  return false
+}
+
+// secretAAD binds a stored secret to its source and key, so ciphertext cannot
+// be moved to another source or configuration entry.
+func secretAAD(sourceID int64, key string) []byte {
+  return []byte(fmt.Sprintf(`%d/%s`, sourceID, key))
+}
+
+func encryptSecret(sourceID int64, key string, value string) (string, error) {
+  if len(secretKeys) == 0 {
+    return ``, fmt.Errorf(`no secret key configured`)
+  }
+  current := secretKeys[0]
+  nonce := make([]byte, current.aead.NonceSize())
+  if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+    return ``, err
+  }
+  sealed := current.aead.Seal(nonce, nonce, []byte(value), secretAAD(sourceID, key))
+  return encryptedSecretPrefix + current.id + `:` + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret decrypts a stored secret. The ID of the key used is returned,
+// or '' for a plain text value.
+func decryptSecret(sourceID int64, key string, stored string) (string, string, error) {
+  if !strings.HasPrefix(stored, encryptedSecretPrefix) {
+    return stored, ``, nil
+  }
+  parts := strings.SplitN(strings.TrimPrefix(stored, encryptedSecretPrefix), `:`, 2)
+  if len(parts) != 2 {
+    return ``, ``, fmt.Errorf(`malformed secret '%s'`, key)
+  }
+  var keyToUse *secretKey
+  for _, candidate := range secretKeys {
+    if candidate.id == parts[0] {
+      keyToUse = candidate
+    }
+  }
+  if keyToUse == nil {
+    return ``, ``, fmt.Errorf(`secret '%s' is encrypted with unknown key '%s'`, key, parts[0])
+  }
+  sealed, err := base64.StdEncoding.DecodeString(parts[1])
+  if err != nil || len(sealed) < keyToUse.aead.NonceSize() {
+    return ``, ``, fmt.Errorf(`malformed secret '%s'`, key)
+  }
+  nonceSize := keyToUse.aead.NonceSize()
+  value, err := keyToUse.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], secretAAD(sourceID, key))
+  if err != nil {
+    return ``, ``, fmt.Errorf(`could not decrypt secret '%s'`, key)
+  }
+  return string(value), keyToUse.id, nil
+}
+
+// isCredentialURLConfig determines whether the configuration key holds a URL
+// which may embed credentials, such as a GIT 'repository'. Such values are
+// returned with the credentials redacted (see redactRepositoryURL) rather than
+// replaced wholesale.
+func isCredentialURLConfig(sourceType string, key string) bool {
+  return sourceType == `GIT` && key == `repository`
+}
+
+// redactSecrets replaces any secret configuration with RedactedSecret and
+// redacts credentials embedded in URLs.
+func redactSecrets(cs *model.ContentSource) {
+  for key, value := range cs.Config {
+    if !value.IsValid() {
+      continue
+    }
+    if isSecretConfig(cs.SourceType.String, key) {
+      cs.Config[key] = nulls.NewString(RedactedSecret)
+    } else if isCredentialURLConfig(cs.SourceType.String, key) {
+      cs.Config[key] = nulls.NewString(redactRepositoryURL(value.String))
+    }
+  }
+}
+
+// storedCredentialURLValue determines the value to store for a URL which may
+// embed credentials. A value matching the redacted form of the currently
+// stored URL keeps the stored URL.
+func storedCredentialURLValue(key string, value nulls.String, current map[string]nulls.String) nulls.String {
+  stored, ok := current[key]
+  if !value.IsValid() || !ok || !stored.IsValid() {
+    return value
+  }
+  if redacted := redactRepositoryURL(stored.String); redacted != stored.String && value.String == redacted {
+    return stored
+  }
+  return value
+}
+
+// storedSecretValue determines the value to store for a secret configuration
+// entry. The redacted value keeps the currently stored secret.
+func storedSecretValue(sourceID int64, key string, value nulls.String, current map[string]nulls.String) (nulls.String, error) {
+  if !value.IsValid() {
+    return value, nil
+  }
+  if value.String == RedactedSecret {
+    stored, ok := current[key]
+    if !ok || !stored.IsValid() {
+      return value, fmt.Errorf(`no current value for secret '%s'`, key)
+    }
+    if strings.HasPrefix(stored.String, encryptedSecretPrefix) {
+      return stored, nil
+    }
+    value = stored // plain text from before encryption; encrypt it now
+  }
+  encrypted, err := encryptSecret(sourceID, key, value.String)
+  if err != nil {
+    return value, err
+  }
+  return nulls.NewString(encrypted), nil
+}
+
+// listStoredConfig retrieves the configuration of the source as stored; i.e.,
+// with secrets encrypted.
+func listStoredConfig(sourceID int64, ctx context.Context, txn *sql.Tx) (map[string]nulls.String, error) {
+  stmt := listContentSourceConfigStmt
+  if txn != nil {
+    stmt = txn.Stmt(stmt)
+  }
+  rows, err := stmt.QueryContext(ctx, sourceID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  config := make(map[string]nulls.String)
+  for rows.Next() {
+    var key string
+    var value nulls.String
+    if err := rows.Scan(&key, &value); err != nil {
+      return nil, err
+    }
+    config[key] = value
+  }
+  return config, rows.Err()
+}
+
+// withContentSourceSecrets returns a copy of the content source with the
+// secrets decrypted and any URL credentials restored. It is used only to sync;
+// the result must never be returned in a response or logged.
+func withContentSourceSecrets(cs *model.ContentSource, ctx context.Context) (*model.ContentSource, rest.RestError) {
+  stored, err := listStoredConfig(cs.Id.Int64, ctx, nil)
+  if err != nil {
+    return nil, rest.ServerError(fmt.Sprintf(`Could not retrieve configuration for content source '%s'.`, cs.Name.String), err)
+  }
+
+  decrypted := *cs
+  decrypted.Config = make(map[string]nulls.String, len(cs.Config))
+  for key, value := range cs.Config {
+    decrypted.Config[key] = value
+  }
+  for key, value := range stored {
+    if value.IsValid() && isCredentialURLConfig(cs.SourceType.String, key) {
+      decrypted.Config[key] = value
+    }
+    if !value.IsValid() || !isSecretConfig(cs.SourceType.String, key) {
+      continue
+    }
+    secret, _, err := decryptSecret(cs.Id.Int64, key, value.String)
+    if err != nil {
+      return nil, rest.ServerError(fmt.Sprintf(`Could not read secrets for content source '%s'.`, cs.Name.String), err)
+    }
+    decrypted.Config[key] = nulls.NewString(secret)
+  }
+
+  return &decrypted, nil
+}
+
+type storedSecret struct {
+  source int64
+  key    string
+  value  string
+}
+
+// listStoredSecrets retrieves the secrets of all content sources as stored.
+func listStoredSecrets(ctx context.Context) ([]*storedSecret, error) {
+  rows, err := listAllContentSourceConfigStmt.QueryContext(ctx)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  secrets := make([]*storedSecret, 0)
+  for rows.Next() {
+    var secret storedSecret
+    var sourceType string
+    var value nulls.String
+    if err := rows.Scan(&secret.source, &sourceType, &secret.key, &value); err != nil {
+      return nil, err
+    }
+    if value.IsValid() && isSecretConfig(sourceType, secret.key) {
+      secret.value = value.String
+      secrets = append(secrets, &secret)
+    }
+  }
+  return secrets, rows.Err()
+}
+
+// CountContentSourceSecrets counts the stored content source secrets which are
+// encrypted and those still in plain text. Encrypted secrets cannot be read,
+// and no secret can be saved, without secret keys (see SetSecretKeys).
+func CountContentSourceSecrets(ctx context.Context) (int, int, error) {
+  secrets, err := listStoredSecrets(ctx)
+  if err != nil {
+    return 0, 0, err
+  }
+  encrypted := 0
+  for _, secret := range secrets {
+    if strings.HasPrefix(secret.value, encryptedSecretPrefix) {
+      encrypted++
+    }
+  }
+  return encrypted, len(secrets) - encrypted, nil
+}
+
+// RewrapContentSourceSecrets encrypts any plain text secrets and re-encrypts
+// secrets stored under a key other than the current one. It returns the number
+// of secrets rewritten. Secrets which cannot be decrypted are logged and
+// skipped.
+func RewrapContentSourceSecrets(ctx context.Context) (int, error) {
+  if len(secretKeys) == 0 {
+    return 0, fmt.Errorf(`no secret key configured`)
+  }
+
+  secrets, err := listStoredSecrets(ctx)
+  if err != nil {
+    return 0, err
+  }
+
+  count := 0
+  for _, secret := range secrets {
+    value, keyID, err := decryptSecret(secret.source, secret.key, secret.value)
+    if err != nil {
+      log.Printf(`Could not rewrap secret for content source %d: %v`, secret.source, err)
+      continue
+    }
+    if keyID == secretKeys[0].id {
+      continue
+    }
+    encrypted, err := encryptSecret(secret.source, secret.key, value)
+    if err != nil {
+      return count, err
+    }
+    // Skip values changed since they were read.
+    res, err := rewrapContentSourceSecretStmt.ExecContext(ctx, encrypted, secret.source, secret.key, secret.value)
+    if err != nil {
+      return count, err
+    }
+    if affected, err := res.RowsAffected(); err == nil && affected > 0 {
+      count++
+    }
+  }
+
+  return count, nil
+}
@@ -0,0 +1,121 @@
+package content
+
+import (
+  "fmt"
+  "net/http"
+  "strconv"
+
+  "github.com/gorilla/mux"
+
+  "github.com/Liquid-Labs/catalyst-core-api/go/handlers"
+  "github.com/Liquid-Labs/go-rest/rest"
+
+  model "github.com/Liquid-Labs/catalyst-content-model/go/resources/content"
+)
+
+func sourceCreateHandler(w http.ResponseWriter, r *http.Request) {
+  if !requireAdmin(w, r) {
+    return // response handled by requireAdmin
+  }
+  source := &model.ContentSource{}
+  if restErr := rest.ExtractJson(w, r, source, `ContentSource`); restErr != nil {
+    return // response handled by ExtractJson
+  }
+
+  newSource, restErr := CreateContentSource(source, r.Context())
+  handlers.ProcessGenericResults(w, r, newSource, restErr, `Content source created.`)
+}
+
+func sourceListHandler(w http.ResponseWriter, r *http.Request) {
+  if _, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  }
+
+  sources, restErr := ListContentSources(r.Context())
+  handlers.ProcessGenericResults(w, r, sources, restErr, `List content sources.`)
+}
+
+func sourceDetailHandler(w http.ResponseWriter, r *http.Request) {
+  if _, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  }
+
+  source, restErr := GetContentSource(mux.Vars(r)["pubID"], r.Context())
+  handlers.ProcessGenericResults(w, r, source, restErr, `Retrieve content source.`)
+}
+
+func sourceUpdateHandler(w http.ResponseWriter, r *http.Request) {
+  if !requireAdmin(w, r) {
+    return // response handled by requireAdmin
+  }
+  source := &model.ContentSource{}
+  if restErr := rest.ExtractJson(w, r, source, `ContentSource`); restErr != nil {
+    return // response handled by ExtractJson
+  }
+  if !handlers.CheckUpdateByPubID(w, mux.Vars(r)["pubID"], source) {
+    return // response handled by CheckUpdateByPubID
+  }
+
+  newSource, restErr := UpdateContentSource(source, r.Context())
+  handlers.ProcessGenericResults(w, r, newSource, restErr, `Content source updated.`)
+}
+
+func sourceDeleteHandler(w http.ResponseWriter, r *http.Request) {
+  if !requireAdmin(w, r) {
+    return // response handled by requireAdmin
+  }
+
+  restErr := DeleteContentSource(mux.Vars(r)["pubID"], r.Context())
+  handlers.ProcessGenericResults(w, r, nil, restErr, `Content source deleted.`)
+}
+
+func sourceSyncRunsHandler(w http.ResponseWriter, r *http.Request) {
+  if _, restErr := handlers.BasicAuthCheck(w, r); restErr != nil {
+    return // response handled by BasicAuthCheck
+  }
+
+  limit := defaultListLimit
+  if limitString := r.URL.Query().Get(`limit`); limitString != `` {
+    var err error
+    if limit, err = strconv.Atoi(limitString); err != nil || limit < 1 || limit > maxListLimit {
+      rest.HandleError(w, rest.BadRequestError(fmt.Sprintf(`Invalid limit: '%s'; must be between 1 and %d.`, limitString, maxListLimit), err))
+      return
+    }
+  }
+
+  runs, restErr := ListSyncRuns(mux.Vars(r)["pubID"], limit, r.Context())
+  handlers.ProcessGenericResults(w, r, runs, restErr, `List sync runs.`)
+}
+
+// sourceGitlabPushHandler receives GitLab push webhooks. The request is
+// authenticated by the 'X-Gitlab-Token' rather than the usual credentials.
+func sourceGitlabPushHandler(w http.ResponseWriter, r *http.Request) {
+  source, restErr := GetContentSource(mux.Vars(r)["pubID"], r.Context())
+  if restErr != nil {
+    rest.HandleError(w, restErr)
+    return
+  }
+  if restErr := VerifyGitlabWebhookToken(source, r.Header.Get(`X-Gitlab-Token`), r.Context()); restErr != nil {
+    rest.HandleError(w, restErr)
+    return
+  }
+
+  event := &GitlabPushEvent{}
+  r.Body = http.MaxBytesReader(w, r.Body, maxGitlabPushEventSize)
+  if restErr := rest.ExtractJson(w, r, event, `GitlabPushEvent`); restErr != nil {
+    return // response handled by ExtractJson
+  }
+
+  summary, restErr := SyncGitlabPush(source, event, r.Context())
+  handlers.ProcessGenericResults(w, r, summary, restErr, `GitLab push synced.`)
+}
+
+func initSourceAPI(r *mux.Router) {
+  r.HandleFunc("/content-sources/", sourceCreateHandler).Methods("POST")
+  r.HandleFunc("/content-sources/", sourceListHandler).Methods("GET")
+  r.HandleFunc("/content-sources/{pubID:" + uuidReString + "}/", sourceDetailHandler).Methods("GET")
+  r.HandleFunc("/content-sources/{pubID:" + uuidReString + "}/", sourceUpdateHandler).Methods("PUT")
+  r.HandleFunc("/content-sources/{pubID:" + uuidReString + "}/", sourceDeleteHandler).Methods("DELETE")
+  r.HandleFunc("/content-sources/{pubID:" + uuidReString + "}/sync-runs/", sourceSyncRunsHandler).Methods("GET")
+  r.HandleFunc("/content-sources/{pubID:" + uuidReString + "}/gitlab-push/", sourceGitlabPushHandler).Methods("POST")
+}
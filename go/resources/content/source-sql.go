@@ -0,0 +1,301 @@
+package content
+
+import (
+  "context"
+  "database/sql"
+  "fmt"
+  "sort"
+  "strings"
+
+  "github.com/Liquid-Labs/go-api/sqldb"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/Liquid-Labs/go-rest/rest"
+  "github.com/Liquid-Labs/catalyst-core-api/go/resources/entities"
+
+  model "github.com/Liquid-Labs/catalyst-content-model/go/resources/content"
+)
+
+// contentSourceConfigSpec defines the configuration keys understood by a
+// source type. Secret keys, drawn from the required and optional keys, are
+// encrypted at rest and redacted when retrieved; see secrets.go.
+type contentSourceConfigSpec struct {
+  Required []string
+  Optional []string
+  Secret   []string
+}
+
+// contentSourceTypes maps the syncable source types to their configuration
+// spec.
+var contentSourceTypes = map[string]contentSourceConfigSpec{
+  `GITLAB`: {
+    Required: []string{`apiHost`, `projectID`},
+    Optional: []string{`apiToken`, `contentPath`, `ref`, `webhookToken`},
+    Secret:   []string{`apiToken`, `webhookToken`},
+  },
+  `GITHUB`: {
+    Required: []string{`owner`, `repo`},
+    Optional: []string{`apiToken`, `apiURL`, `contentPath`, `ref`},
+    Secret:   []string{`apiToken`},
+  },
+  `GIT`: {
+    Required: []string{`repository`},
+    Optional: []string{`contentPath`, `ref`},
+  },
+  `LOCAL_DIR`: {
+    Required: []string{`directory`},
+    Optional: []string{`contentPath`},
+  },
+  `S3`: {
+    Required: []string{`bucket`},
+    Optional: []string{`accessKeyID`, `contentPath`, `endpoint`, `region`, `secretAccessKey`},
+    Secret:   []string{`secretAccessKey`},
+  },
+}
+
+// ValidateContentSource verifies the source type is known, the required
+// configuration is present, and there is no unknown configuration.
+func ValidateContentSource(cs *model.ContentSource) rest.RestError {
+  if cs.Name.IsEmpty() {
+    return rest.BadRequestError(`Content source must specify a (namespace) 'name'.`, nil)
+  }
+  spec, ok := contentSourceTypes[cs.SourceType.String]
+  if !ok {
+    return rest.BadRequestError(fmt.Sprintf(`Unknown content source type: '%s'.`, cs.SourceType.String), nil)
+  }
+
+  known := make(map[string]bool)
+  missing := make([]string, 0)
+  for _, key := range spec.Required {
+    known[key] = true
+    if cs.Config[key].IsEmpty() {
+      missing = append(missing, key)
+    }
+  }
+  for _, key := range spec.Optional {
+    known[key] = true
+  }
+  if len(missing) > 0 {
+    return rest.BadRequestError(fmt.Sprintf(`%s content source missing required configuration: %s.`, cs.SourceType.String, strings.Join(missing, `, `)), nil)
+  }
+
+  unknown := make([]string, 0)
+  for key := range cs.Config {
+    if !known[key] {
+      unknown = append(unknown, key)
+    }
+  }
+  if len(unknown) > 0 {
+    sort.Strings(unknown)
+    return rest.BadRequestError(fmt.Sprintf(`Unknown %s content source configuration: %s.`, cs.SourceType.String, strings.Join(unknown, `, `)), nil)
+  }
+
+  if cs.SourceType.String == `LOCAL_DIR` {
+    if _, err := resolveLocalDir(cs.Config[`directory`].String); err != nil {
+      return rest.BadRequestError(fmt.Sprintf(`Invalid LOCAL_DIR directory: %v.`, err), err)
+    }
+  }
+
+  return nil
+}
+
+func CreateContentSource(cs *model.ContentSource, ctx context.Context) (*model.ContentSource, rest.RestError) {
+  if restErr := ValidateContentSource(cs); restErr != nil {
+    return nil, restErr
+  }
+  if _, restErr := getNamespaceIDByName(cs.Name.String, ctx); restErr != nil {
+    return nil, restErr
+  }
+
+  txn, err := sqldb.DB.Begin()
+  if err != nil {
+    return nil, rest.ServerError("Could not create content source. (txn error)", err)
+  }
+
+  id, restErr := entities.CreateEntityInTxn(txn)
+  if restErr != nil {
+    defer txn.Rollback()
+    return nil, restErr
+  }
+  if _, err := txn.Stmt(createContentSourceStmt).ExecContext(ctx, id, cs.SourceType, cs.Name); err != nil {
+    defer txn.Rollback()
+    // TODO: distinguish the (likely) duplicate name from other errors
+    return nil, rest.UnprocessableEntityError(fmt.Sprintf(`Could not create content source for '%s'; possible duplicate.`, cs.Name.String), err)
+  }
+  if restErr := insertContentSourceConfigInTxn(id, cs, nil, ctx, txn); restErr != nil {
+    return nil, restErr // already rolled back
+  }
+
+  newSource, restErr := getContentSourceHelper(getContentSourceByIDStmt, ctx, txn, id)
+  if restErr != nil {
+    defer txn.Rollback()
+    return nil, restErr
+  }
+  if err := txn.Commit(); err != nil {
+    return nil, rest.ServerError("Could not create content source. (commit error)", err)
+  }
+
+  return newSource, nil
+}
+
+// insertContentSourceConfigInTxn saves the configuration, encrypting secrets.
+// A redacted secret or URL keeps the value from the 'current' stored
+// configuration.
+func insertContentSourceConfigInTxn(id int64, cs *model.ContentSource, current map[string]nulls.String, ctx context.Context, txn *sql.Tx) rest.RestError {
+  insStmt := txn.Stmt(contentSourceConfigInsertStmt)
+  for key, value := range cs.Config {
+    if isCredentialURLConfig(cs.SourceType.String, key) {
+      value = storedCredentialURLValue(key, value, current)
+    } else if isSecretConfig(cs.SourceType.String, key) {
+      var err error
+      if value, err = storedSecretValue(id, key, value, current); err != nil {
+        defer txn.Rollback()
+        return rest.UnprocessableEntityError(fmt.Sprintf(`Could not save content source secret '%s': %v.`, key, err), err)
+      }
+    }
+    if _, err := insStmt.ExecContext(ctx, id, key, value); err != nil {
+      defer txn.Rollback()
+      return rest.ServerError(fmt.Sprintf(`Could not save content source configuration '%s'.`, key), err)
+    }
+  }
+  return nil
+}
+
+// GetContentSource retrieves a model.ContentSource, including its
+// configuration, from a public ID string (UUID). Attempting to retrieve a
+// non-existent item results in a rest.NotFoundError.
+func GetContentSource(pubID string, ctx context.Context) (*model.ContentSource, rest.RestError) {
+  return getContentSourceHelper(getContentSourceStmt, ctx, nil, pubID)
+}
+
+// GetContentSourceByName retrieves the model.ContentSource for the named
+// namespace. See GetContentSource.
+func GetContentSourceByName(name string, ctx context.Context) (*model.ContentSource, rest.RestError) {
+  return getContentSourceHelper(getContentSourceByNameStmt, ctx, nil, name)
+}
+
+// ListContentSources retrieves all model.ContentSource, ordered by name.
+func ListContentSources(ctx context.Context) ([]*model.ContentSource, rest.RestError) {
+  rows, err := listContentSourcesStmt.QueryContext(ctx)
+  if err != nil {
+    return nil, rest.ServerError("Error retrieving content sources.", err)
+  }
+  defer rows.Close()
+
+  sources, err := buildContentSources(rows)
+  if err != nil {
+    return nil, rest.ServerError("Problem getting data for content sources.", err)
+  }
+  return sources, nil
+}
+
+func getContentSourceHelper(stmt *sql.Stmt, ctx context.Context, txn *sql.Tx, ids ...interface{}) (*model.ContentSource, rest.RestError) {
+  if txn != nil {
+    stmt = txn.Stmt(stmt)
+  }
+  rows, err := stmt.QueryContext(ctx, ids...)
+  if err != nil {
+    return nil, rest.ServerError("Error retrieving content source.", err)
+  }
+  defer rows.Close()
+
+  sources, err := buildContentSources(rows)
+  if err != nil {
+    return nil, rest.ServerError(fmt.Sprintf("Problem getting data for content source: '%v'", ids), err)
+  }
+  if len(sources) == 0 {
+    return nil, rest.NotFoundError(fmt.Sprintf(`Content source '%v' not found.`, ids), nil)
+  }
+
+  return sources[0], nil
+}
+
+// buildContentSources processes content source rows. Like the contributors for
+// content, each config entry yields a row. Secrets are redacted.
+func buildContentSources(rows *sql.Rows) ([]*model.ContentSource, error) {
+  sources := make([]*model.ContentSource, 0)
+  var source *model.ContentSource
+  for rows.Next() {
+    var cs model.ContentSource
+    var configKey, configValue nulls.String
+    if err := rows.Scan(&cs.Id, &cs.PubId, &cs.LastUpdated, &cs.SourceType, &cs.Name, &configKey, &configValue); err != nil {
+      return nil, err
+    }
+    if source == nil || source.PubId.String != cs.PubId.String {
+      source = &cs
+      source.Config = make(map[string]nulls.String)
+      sources = append(sources, source)
+    }
+    if configKey.IsValid() {
+      source.Config[configKey.String] = configValue
+    }
+  }
+  for _, source := range sources {
+    redactSecrets(source)
+  }
+
+  return sources, nil
+}
+
+// UpdateContentSource updates the source type, name, and configuration. The
+// configuration is replaced wholesale.
+func UpdateContentSource(cs *model.ContentSource, ctx context.Context) (*model.ContentSource, rest.RestError) {
+  if restErr := ValidateContentSource(cs); restErr != nil {
+    return nil, restErr
+  }
+  if _, restErr := getNamespaceIDByName(cs.Name.String, ctx); restErr != nil {
+    return nil, restErr
+  }
+
+  txn, err := sqldb.DB.Begin()
+  if err != nil {
+    return nil, rest.ServerError("Could not update content source. (txn error)", err)
+  }
+
+  current, restErr := getContentSourceHelper(getContentSourceStmt, ctx, txn, cs.PubId)
+  if restErr != nil {
+    defer txn.Rollback()
+    return nil, restErr
+  }
+  if _, err := txn.Stmt(updateContentSourceStmt).ExecContext(ctx, cs.SourceType, cs.Name, cs.PubId); err != nil {
+    defer txn.Rollback()
+    return nil, rest.UnprocessableEntityError(fmt.Sprintf(`Could not update content source '%s'; possible duplicate name.`, cs.PubId.String), err)
+  }
+  currentConfig, err := listStoredConfig(current.Id.Int64, ctx, txn)
+  if err != nil {
+    defer txn.Rollback()
+    return nil, rest.ServerError("Could not update content source configuration (read phase).", err)
+  }
+  if _, err := txn.Stmt(contentSourceConfigDeleteStmt).ExecContext(ctx, current.Id); err != nil {
+    defer txn.Rollback()
+    return nil, rest.ServerError("Could not update content source configuration (clear phase).", err)
+  }
+  if restErr := insertContentSourceConfigInTxn(current.Id.Int64, cs, currentConfig, ctx, txn); restErr != nil {
+    return nil, restErr // already rolled back
+  }
+
+  newSource, restErr := getContentSourceHelper(getContentSourceStmt, ctx, txn, cs.PubId)
+  if restErr != nil {
+    defer txn.Rollback()
+    return nil, restErr
+  }
+  if err := txn.Commit(); err != nil {
+    return nil, rest.ServerError("Could not update content source. (commit error)", err)
+  }
+
+  return newSource, nil
+}
+
+// DeleteContentSource removes the content source. The content already synced
+// to the namespace is unaffected.
+func DeleteContentSource(pubID string, ctx context.Context) rest.RestError {
+  res, err := deleteContentSourceStmt.ExecContext(ctx, pubID)
+  if err != nil {
+    return rest.ServerError(fmt.Sprintf(`Could not delete content source '%s'.`, pubID), err)
+  }
+  if count, err := res.RowsAffected(); err != nil {
+    return rest.ServerError(`Could not verify content source deletion.`, err)
+  } else if count == 0 {
+    return rest.NotFoundError(fmt.Sprintf(`Content source '%s' not found.`, pubID), nil)
+  }
+  return nil
+}
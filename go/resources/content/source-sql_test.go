@@ -0,0 +1,25 @@
+package content
+
+import (
+  "context"
+  "database/sql/driver"
+  "net/http"
+  "strings"
+  "testing"
+)
+
+func TestCreateContentSourceRequiresNamespace(t *testing.T) {
+  defer useFakeDB(t, map[string]fakeQueryHandler{
+    getNamespaceIDByNameQuery : func(args []driver.Value) ([]string, [][]driver.Value, error) {
+      return fakeColumns(1), nil, nil
+    },
+  })()
+
+  _, restErr := CreateContentSource(gitlabTestSource(`gitlab.example.com`), context.Background())
+  if restErr == nil {
+    t.Fatalf(`expected error creating source for unknown namespace`)
+  }
+  if restErr.Code() != http.StatusNotFound || !strings.Contains(restErr.Error(), `Namespace 'site' not found`) {
+    t.Errorf(`unexpected error: %d %s`, restErr.Code(), restErr.Error())
+  }
+}
@@ -17,7 +17,64 @@ var createContentStmt,
   updateContentTypeTextOnlyTextStmt,
   contributorsDeleteStmt,
   contributorInsertStmt,
-  contributorInsertWithContentIDStmt *sql.Stmt
+  contributorInsertWithContentIDStmt,
+  getContentIDByPubIDStmt,
+  getEntityIDByPubIDStmt,
+  contextContentInsertStmt,
+  contextContentDeleteStmt,
+  contentIsDeletedStmt,
+  contentSoftDeleteStmt,
+  contentRestoreStmt,
+  contentPurgeContributorsStmt,
+  contentPurgeTypeTextStmt,
+  contentPurgeSummaryStmt,
+  contentPurgeEntityStmt,
+  getContentSourceStmt,
+  getContentSourceByNameStmt,
+  getContentSourceByIDStmt,
+  getContentRefStmt,
+  getContentRefByNSSlugStmt,
+  createContentTypeAssetStmt,
+  getContentTypeAssetStmt,
+  getContentTypeAssetByIDStmt,
+  updateContentSummaryStmt,
+  lockContentTypeAssetBlobKeyStmt,
+  updateContentTypeAssetDataStmt,
+  getContentTypeAssetBlobKeyByIDStmt,
+  contentPurgeTypeAssetStmt,
+  listContentSourcesStmt,
+  createContentSourceStmt,
+  updateContentSourceStmt,
+  contentSourceConfigDeleteStmt,
+  contentSourceConfigInsertStmt,
+  deleteContentSourceStmt,
+  getNamespaceIDByNameStmt,
+  getNamespaceStmt,
+  listNamespacesStmt,
+  createNamespaceStmt,
+  updateNamespaceStmt,
+  updateContentSourceNameStmt,
+  archiveNamespaceStmt,
+  unarchiveNamespaceStmt,
+  lockContentForRevisionStmt,
+  carryContentRevisionStmt,
+  createContentRevisionStmt,
+  listContentRevisionsStmt,
+  getContentRevisionStmt,
+  getContentRevisionNumberStmt,
+  lockContentVersionStmt,
+  listSyncedContentStmt,
+  listNamespaceContentStmt,
+  updateSyncedTextStmt,
+  listURLContentStmt,
+  createSyncRunStmt,
+  failInterruptedSyncRunsStmt,
+  getLastSyncRunStmt,
+  finishSyncRunStmt,
+  listSyncRunsStmt,
+  listContentSourceConfigStmt,
+  listAllContentSourceConfigStmt,
+  rewrapContentSourceSecretStmt *sql.Stmt
 
 func SetupDB(db *sql.DB) {
   stmtMap := map[string]**sql.Stmt{
@@ -32,6 +89,63 @@ func SetupDB(db *sql.DB) {
     queries.ContributorsDeleteQuery: &contributorsDeleteStmt,
     queries.ContributorInsertQuery: &contributorInsertStmt,
     queries.ContributorInsertWithContentIDQuery: &contributorInsertWithContentIDStmt,
+    getContentIDByPubIDQuery: &getContentIDByPubIDStmt,
+    getEntityIDByPubIDQuery: &getEntityIDByPubIDStmt,
+    contextContentInsertQuery: &contextContentInsertStmt,
+    contextContentDeleteQuery: &contextContentDeleteStmt,
+    contentIsDeletedQuery: &contentIsDeletedStmt,
+    contentSoftDeleteQuery: &contentSoftDeleteStmt,
+    contentRestoreQuery: &contentRestoreStmt,
+    contentPurgeContributorsQuery: &contentPurgeContributorsStmt,
+    contentPurgeTypeTextQuery: &contentPurgeTypeTextStmt,
+    contentPurgeSummaryQuery: &contentPurgeSummaryStmt,
+    contentPurgeEntityQuery: &contentPurgeEntityStmt,
+    getContentSourceQuery: &getContentSourceStmt,
+    getContentSourceByNameQuery: &getContentSourceByNameStmt,
+    getContentSourceByIDQuery: &getContentSourceByIDStmt,
+    getContentRefQuery: &getContentRefStmt,
+    getContentRefByNSSlugQuery: &getContentRefByNSSlugStmt,
+    createContentTypeAssetQuery: &createContentTypeAssetStmt,
+    getContentTypeAssetQuery: &getContentTypeAssetStmt,
+    getContentTypeAssetByIDQuery: &getContentTypeAssetByIDStmt,
+    updateContentSummaryQuery: &updateContentSummaryStmt,
+    lockContentTypeAssetBlobKeyQuery: &lockContentTypeAssetBlobKeyStmt,
+    updateContentTypeAssetDataQuery: &updateContentTypeAssetDataStmt,
+    getContentTypeAssetBlobKeyByIDQuery: &getContentTypeAssetBlobKeyByIDStmt,
+    contentPurgeTypeAssetQuery: &contentPurgeTypeAssetStmt,
+    listContentSourcesQuery: &listContentSourcesStmt,
+    createContentSourceQuery: &createContentSourceStmt,
+    updateContentSourceQuery: &updateContentSourceStmt,
+    contentSourceConfigDeleteQuery: &contentSourceConfigDeleteStmt,
+    contentSourceConfigInsertQuery: &contentSourceConfigInsertStmt,
+    deleteContentSourceQuery: &deleteContentSourceStmt,
+    getNamespaceIDByNameQuery: &getNamespaceIDByNameStmt,
+    getNamespaceQuery: &getNamespaceStmt,
+    listNamespacesQuery: &listNamespacesStmt,
+    createNamespaceQuery: &createNamespaceStmt,
+    updateNamespaceQuery: &updateNamespaceStmt,
+    updateContentSourceNameQuery: &updateContentSourceNameStmt,
+    archiveNamespaceQuery: &archiveNamespaceStmt,
+    unarchiveNamespaceQuery: &unarchiveNamespaceStmt,
+    lockContentForRevisionQuery: &lockContentForRevisionStmt,
+    carryContentRevisionQuery: &carryContentRevisionStmt,
+    createContentRevisionQuery: &createContentRevisionStmt,
+    listContentRevisionsQuery: &listContentRevisionsStmt,
+    getContentRevisionQuery: &getContentRevisionStmt,
+    getContentRevisionNumberQuery: &getContentRevisionNumberStmt,
+    lockContentVersionQuery: &lockContentVersionStmt,
+    listSyncedContentQuery: &listSyncedContentStmt,
+    listNamespaceContentQuery: &listNamespaceContentStmt,
+    updateSyncedTextQuery: &updateSyncedTextStmt,
+    listURLContentQuery: &listURLContentStmt,
+    createSyncRunQuery: &createSyncRunStmt,
+    failInterruptedSyncRunsQuery: &failInterruptedSyncRunsStmt,
+    getLastSyncRunQuery: &getLastSyncRunStmt,
+    finishSyncRunQuery: &finishSyncRunStmt,
+    listSyncRunsQuery: &listSyncRunsStmt,
+    listContentSourceConfigQuery: &listContentSourceConfigStmt,
+    listAllContentSourceConfigQuery: &listAllContentSourceConfigStmt,
+    rewrapContentSourceSecretQuery: &rewrapContentSourceSecretStmt,
   }
 
   for query, permPointer := range stmtMap {
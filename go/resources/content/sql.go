@@ -4,6 +4,7 @@ import (
   "context"
   "database/sql"
   "fmt"
+  "log"
 
   "github.com/Liquid-Labs/go-api/sqldb"
   "github.com/Liquid-Labs/go-nullable-mysql/nulls"
@@ -13,10 +14,15 @@ import (
   model "github.com/Liquid-Labs/catalyst-content-model/go/resources/content"
 )
 
+// ContentSorts maps the 'sort' parameter to the 'ORDER BY' clause. The
+// 'relevance' sort orders search results by full-text score; see search.go.
 var ContentSorts = map[string]string{
-  "": `c.content ASC `,
-  `title-asc`: `c.content ASC `,
-  `title-desc`: `c.content DESC `,
+  "": `c.title ASC `,
+  `title-asc`: `c.title ASC `,
+  `title-desc`: `c.title DESC `,
+  `last-updated-asc`: `e.last_updated ASC `,
+  `last-updated-desc`: `e.last_updated DESC `,
+  `relevance`: `relevance DESC, c.title ASC `,
 }
 
 func scanContentSummary(row *sql.Rows) (*model.ContentSummary, *model.ContributorSummary, error) {
@@ -48,41 +54,158 @@ func scanContentTypeTextDetail(row *sql.Rows) (*model.ContentTypeText, *model.Co
 
 // implement rest.ResultBuilder
 func BuildContentResults(rows *sql.Rows) (interface{}, error) {
-  var lastID int64 = 0
   results := make([]*model.ContentSummary, 0)
-  contributors := make([]*model.ContributorSummary, 0)
   var content *model.ContentSummary
   for rows.Next() {
-    content, contributor, err := scanContentSummary(rows)
+    rowContent, contributor, err := scanContentSummary(rows)
     if err != nil {
       return nil, err
     }
 
-    contributors = append(contributors, contributor)
-    if lastID != content.Id.Int64 {
-      content.Contributors = contributors
+    // Each row carries the summary plus a single contributor, so we start a
+    // new summary whenever the content changes.
+    if content == nil || content.PubId.String != rowContent.PubId.String {
+      content = rowContent
+      content.Contributors = make(model.ContributorSummaries, 0)
       results = append(results, content)
-      contributors = make([]*model.ContributorSummary, 0)
     }
-  }
-
-  if content != nil {
-    content.Contributors = contributors
-    results = append(results, content)
+    // contributors are left-joined; content without contributors yields a
+    // single row with a null contributor
+    if contributor.PubId.IsValid() {
+      content.Contributors = append(content.Contributors, contributor)
+    }
   }
 
   return results, nil
 }
 
-// Implements rest.GeneralSearchWhereBit
+// Implements rest.GeneralSearchWhereBit. The term is a full-text boolean query
+// matched against the title and summary or the text, or a partial contributor
+// name; see search.go.
 func ContentGeneralWhereGenerator(term string, params []interface{}) (string, []interface{}, error) {
-  likeTerm := `%`+term+`%`
-  whereBit := "AND (c.title LIKE ? OR p.display_name LIKE ?) "
-  params = append(params, likeTerm, likeTerm)
+  whereBit, searchParams := contentSearchWhere(term)
+  params = append(params, searchParams...)
 
   return whereBit, params, nil
 }
 
+// ContentSearchParams captures the optional search, sort, paging, and filter
+// settings for ListContent.
+type ContentSearchParams struct {
+  Search    string
+  Sort      string
+  Page      int
+  Limit     int
+  Namespace string
+  Type      string
+  // ContextType and ContextID, when set, limit results to content associated
+  // with the context entity. See AddContentToContext.
+  ContextType string
+  ContextID   string
+  // Deleted selects the trash (deleted content) rather than live content.
+  Deleted bool
+}
+
+// ContentList is the result of ListContent. TotalCount is the number of items
+// matching the search across all pages.
+type ContentList struct {
+  Items      []*model.ContentSummary `json:"items"`
+  TotalCount int64                   `json:"totalCount"`
+  Page       int                     `json:"page"`
+  Limit      int                     `json:"limit"`
+}
+
+const contentListFrom = `FROM content_summary c JOIN entities e ON c.id=e.id JOIN namespace ns ON c.namespace=ns.id ` +
+  `LEFT JOIN content_type_text t ON t.id=c.id ` +
+  `LEFT JOIN contributors cc ON cc.content=c.id LEFT JOIN persons p ON cc.person=p.id `
+
+const contentListSelect = `SELECT e.pub_id, e.last_updated, c.title, c.summary, ns.name, c.source_type, c.slug, c.type, ` +
+  `pe.pub_id, p.display_name, cc.role, cc.summary_credit_order `
+
+// contentListWhere builds the 'WHERE' clause and parameters common to the
+// count and page queries.
+func contentListWhere(sp *ContentSearchParams) (string, []interface{}, error) {
+  where := `WHERE c.deleted_at IS NULL `
+  if sp.Deleted {
+    where = `WHERE c.deleted_at IS NOT NULL `
+  }
+  params := make([]interface{}, 0)
+  if sp.Namespace != `` {
+    where += `AND ns.name=? `
+    params = append(params, sp.Namespace)
+  }
+  if sp.Type != `` {
+    where += `AND c.type=? `
+    params = append(params, sp.Type)
+  }
+  if sp.ContextID != `` {
+    where += `AND c.id IN (SELECT cx.content FROM content_contexts cx JOIN entities ce ON cx.context=ce.id WHERE ce.pub_id=? AND cx.context_type=?) `
+    params = append(params, sp.ContextID, sp.ContextType)
+  }
+  if sp.Search != `` {
+    searchBit, searchParams, err := ContentGeneralWhereGenerator(sp.Search, params)
+    if err != nil {
+      return ``, nil, err
+    }
+    where += searchBit
+    params = searchParams
+  }
+
+  return where, params, nil
+}
+
+// ListContent retrieves a page of model.ContentSummary matching the search
+// params, along with the total number of matching items. Items are paged by
+// content, rather than by row, so each summary carries its full set of
+// contributors.
+func ListContent(sp *ContentSearchParams, ctx context.Context) (*ContentList, rest.RestError) {
+  sort, ok := ContentSorts[sp.Sort]
+  if !ok {
+    return nil, rest.BadRequestError(fmt.Sprintf(`Invalid sort: '%s'.`, sp.Sort), nil)
+  }
+
+  where, params, err := contentListWhere(sp)
+  if err != nil {
+    return nil, rest.BadRequestError(fmt.Sprintf(`Could not process search: %v.`, err), err)
+  }
+
+  var totalCount int64
+  countQuery := `SELECT COUNT(DISTINCT c.id) ` + contentListFrom + where
+  if err := sqldb.DB.QueryRowContext(ctx, countQuery, params...).Scan(&totalCount); err != nil {
+    return nil, rest.ServerError(`Could not count content.`, err)
+  }
+
+  // The inner query selects the page of IDs, with their relevance; the outer
+  // query then pulls in all contributors for the page. Ordering by ID last keeps
+  // pages stable where the sort ties.
+  relevance, relevanceParams := contentRelevance(sp.Search)
+  pageQuery := `SELECT c.id, ` + relevance + ` AS relevance ` + contentListFrom + where + `GROUP BY c.id ORDER BY ` + sort + `, c.id LIMIT ? OFFSET ?`
+  query := contentListSelect +
+    `FROM (` + pageQuery + `) pg JOIN content_summary c ON pg.id=c.id JOIN entities e ON c.id=e.id ` +
+    `JOIN namespace ns ON c.namespace=ns.id LEFT JOIN contributors cc ON cc.content=c.id ` +
+    `LEFT JOIN persons p ON cc.person=p.id LEFT JOIN entities pe ON p.id=pe.id ` +
+    `ORDER BY ` + sort + `, c.id, cc.summary_credit_order`
+  params = append(append(relevanceParams, params...), sp.Limit, sp.Page * sp.Limit)
+
+  rows, err := sqldb.DB.QueryContext(ctx, query, params...)
+  if err != nil {
+    return nil, rest.ServerError(`Could not retrieve content.`, err)
+  }
+  defer rows.Close()
+
+  results, err := BuildContentResults(rows)
+  if err != nil {
+    return nil, rest.ServerError(`Problem processing content results.`, err)
+  }
+
+  return &ContentList{
+    Items      : results.([]*model.ContentSummary),
+    TotalCount : totalCount,
+    Page       : sp.Page,
+    Limit      : sp.Limit,
+  }, nil
+}
+
 func CreateContentTypeText(c *model.ContentTypeText, ctx context.Context) (*model.ContentTypeText, rest.RestError) {
   txn, err := sqldb.DB.Begin()
   if err != nil {
@@ -113,7 +236,33 @@ func createContentSummaryInTxn(c *model.ContentSummary, txn *sql.Tx) (int64, res
 }
 
 func CreateContentTypeTextInTxn(c *model.ContentTypeText, ctx context.Context, txn *sql.Tx) (*model.ContentTypeText, rest.RestError) {
+  if _, restErr := createContentTypeTextInTxn(c, ctx, txn); restErr != nil {
+    return nil, restErr // already rolled back
+  }
+
+  // The record must be committed before the sync updates it.
+  if err := txn.Commit(); err != nil {
+    return nil, rest.ServerError("Could not create content record. (commit error)", err)
+  }
+
+  newContent, err := SyncContentTypeText(c, ctx)
+  if err != nil {
+    return nil, rest.ServerError("Record created, but could not perform initial sync with external resource.", err)
+  }
+
+  return newContent, nil
+}
+
+// createContentTypeTextInTxn creates the content records and initial revision
+// without committing or syncing.
+func createContentTypeTextInTxn(c *model.ContentTypeText, ctx context.Context, txn *sql.Tx) (*model.ContentTypeText, rest.RestError) {
   var err error
+  if c.SourceType.String == `URL` {
+    if restErr := ValidateContentURL(c.Namespace.String, c.ExternPath.String, ctx); restErr != nil {
+      defer txn.Rollback()
+      return nil, restErr
+    }
+  }
   newID, restErr := createContentSummaryInTxn(&c.ContentSummary, txn)
   if restErr != nil {
     // already rolled back
@@ -137,14 +286,17 @@ func CreateContentTypeTextInTxn(c *model.ContentTypeText, ctx context.Context, t
     }
   }
 
-  defer txn.Commit()
-
-  newContent, err := SyncContentTypeText(c, ctx)
-  if err != nil {
-    return nil, rest.ServerError("Record created, but could not perform initial sync with external resource.", err)
+  created, restErr := GetContentTypeTextByIDInTxn(newID, ctx, txn)
+  if restErr != nil {
+    defer txn.Rollback()
+    return nil, restErr
   }
+  if restErr := recordContentRevisionInTxn(created, ctx, txn); restErr != nil {
+    return nil, restErr // already rolled back
+  }
+  c.PubId = created.PubId
 
-  return newContent, nil
+  return created, nil
 }
 
 // GetContentTypeText retrieves a model.ContentTypeText from a public ID string
@@ -223,11 +375,21 @@ func getContentTypeTextHelper(stmt *sql.Stmt, ctx context.Context, txn *sql.Tx,
 
     contributors = append(contributors, contributor)
 	}
-  if content != nil {
-    content.Contributors = contributors
-  } else {
+  if content == nil {
     return nil, rest.NotFoundError(fmt.Sprintf(`Content '%v' not found.`, ids), nil)
   }
+  // Deleted content is hidden until restored. See DeleteContent.
+  deletedStmt := contentIsDeletedStmt
+  if txn != nil {
+    deletedStmt = txn.Stmt(deletedStmt)
+  }
+  var deleted bool
+  if err := deletedStmt.QueryRowContext(ctx, content.PubId).Scan(&deleted); err != nil {
+    return nil, rest.ServerError(fmt.Sprintf("Problem checking status for content: '%v'", ids), err)
+  } else if deleted {
+    return nil, rest.NotFoundError(fmt.Sprintf(`Content '%v' not found.`, ids), nil)
+  }
+  content.Contributors = contributors
 
 	return content, nil
 }
@@ -264,6 +426,19 @@ func UpdateContentTypeText(c *model.ContentTypeText, ctx context.Context) (*mode
 // transaction. See UpdateContentTypeText.
 func UpdateContentTypeTextInTxn(c *model.ContentTypeText, ctx context.Context, txn *sql.Tx) (*model.ContentTypeText, rest.RestError) {
   var err error
+  // Deleted content must be restored before it can be updated; this results in
+  // a rest.NotFoundError, as with retrieval.
+  current, restErr := GetContentTypeTextInTxn(c.PubId.String, ctx, txn)
+  if restErr != nil {
+    defer txn.Rollback()
+    return nil, restErr
+  }
+  if c.ExternPath.IsValid() && current.SourceType.String == `URL` {
+    if restErr := ValidateContentURL(current.Namespace.String, c.ExternPath.String, ctx); restErr != nil {
+      defer txn.Rollback()
+      return nil, restErr
+    }
+  }
   if (!c.ExternPath.IsValid()) {
     updateStmt := txn.Stmt(updateContentTypeTextWithTextStmt)
     _, err = updateStmt.Exec(c.Title, c.Summary, c.ExternPath, c.Slug, c.Format, c.Text, c.PubId)
@@ -279,9 +454,13 @@ func UpdateContentTypeTextInTxn(c *model.ContentTypeText, ctx context.Context, t
   }
 
   newContent, restErr := GetContentTypeTextInTxn(c.PubId.String, ctx, txn)
-  if err != nil {
+  if restErr != nil {
+    defer txn.Rollback()
     return nil, restErr
   }
+  if restErr := recordContentRevisionInTxn(newContent, ctx, txn); restErr != nil {
+    return nil, restErr // already rolled back
+  }
 
   return newContent, nil
 }
@@ -304,11 +483,14 @@ func UpdateContentTypeTextOnlyText(c *model.ContentTypeText, ctx context.Context
   }
 
   newContent, restErr := GetContentTypeTextInTxn(c.PubId.String, ctx, txn)
-  if err != nil {
+  if restErr != nil {
+    defer txn.Rollback()
     return nil, restErr
-  } else {
-    defer txn.Commit()
   }
+  if restErr := recordContentRevisionInTxn(newContent, ctx, txn); restErr != nil {
+    return nil, restErr // already rolled back
+  }
+  defer txn.Commit()
 
   return newContent, nil
 }
@@ -342,6 +524,164 @@ func UpdateContentTypeTextContributorsInTxn(c *model.ContentTypeText, ctx contex
       return nil, rest.UnprocessableEntityError("Error updating contributors. Possible bad data.", err)
     }
   }
+  if restErr := recordContentChangeInTxn(c.PubId.String, ctx, txn); restErr != nil {
+    return nil, restErr // already rolled back
+  }
 
   return GetContentTypeTextInTxn(c.PubId.String, ctx, txn)
 }
+
+// getIDByPubID resolves a public ID to the internal ID using the given
+// statement. A missing record results in a rest.NotFoundError describing the
+// 'kind' of thing.
+func getIDByPubID(stmt *sql.Stmt, kind string, pubID string, ctx context.Context) (int64, rest.RestError) {
+  var id int64
+  if err := stmt.QueryRowContext(ctx, pubID).Scan(&id); err == sql.ErrNoRows {
+    return 0, rest.NotFoundError(fmt.Sprintf(`%s '%s' not found.`, kind, pubID), nil)
+  } else if err != nil {
+    return 0, rest.ServerError(fmt.Sprintf(`Problem resolving %s '%s'.`, kind, pubID), err)
+  }
+  return id, nil
+}
+
+// getNamespaceIDByName resolves a namespace name to the internal ID. A missing
+// namespace results in a rest.NotFoundError.
+func getNamespaceIDByName(name string, ctx context.Context) (int64, rest.RestError) {
+  var id int64
+  if err := getNamespaceIDByNameStmt.QueryRowContext(ctx, name).Scan(&id); err == sql.ErrNoRows {
+    return 0, rest.NotFoundError(fmt.Sprintf(`Namespace '%s' not found.`, name), nil)
+  } else if err != nil {
+    return 0, rest.ServerError(fmt.Sprintf(`Problem resolving namespace '%s'.`, name), err)
+  }
+  return id, nil
+}
+
+// AddContentToContext associates the content with the context entity so that
+// the content will be included in context listings. Adding content already in
+// the context is a no-op. Referencing non-existent content or context results
+// in a rest.NotFoundError.
+func AddContentToContext(contextType string, contextPubID string, contentPubID string, ctx context.Context) rest.RestError {
+  contentID, restErr := getIDByPubID(getContentIDByPubIDStmt, `Content`, contentPubID, ctx)
+  if restErr != nil {
+    return restErr
+  }
+  contextID, restErr := getIDByPubID(getEntityIDByPubIDStmt, `Context`, contextPubID, ctx)
+  if restErr != nil {
+    return restErr
+  }
+
+  if _, err := contextContentInsertStmt.ExecContext(ctx, contentID, contextID, contextType); err != nil {
+    return rest.ServerError(fmt.Sprintf(`Could not add content '%s' to context '%s/%s'.`, contentPubID, contextType, contextPubID), err)
+  }
+  return nil
+}
+
+// RemoveContentFromContext removes an association created by
+// AddContentToContext. Attempting to remove a non-existent association results
+// in a rest.NotFoundError.
+func RemoveContentFromContext(contextType string, contextPubID string, contentPubID string, ctx context.Context) rest.RestError {
+  res, err := contextContentDeleteStmt.ExecContext(ctx, contextPubID, contextType, contentPubID)
+  if err != nil {
+    return rest.ServerError(fmt.Sprintf(`Could not remove content '%s' from context '%s/%s'.`, contentPubID, contextType, contextPubID), err)
+  }
+  if count, err := res.RowsAffected(); err != nil {
+    return rest.ServerError(`Could not verify content removal.`, err)
+  } else if count == 0 {
+    return rest.NotFoundError(fmt.Sprintf(`Content '%s' not found in context '%s/%s'.`, contentPubID, contextType, contextPubID), nil)
+  }
+  return nil
+}
+
+// DeleteContent soft deletes the content. Deleted content is hidden from
+// retrieval and listing, but remains in the trash (see ListContent) until
+// restored with RestoreContent or removed with PurgeContent. Attempting to
+// delete non-existent or already deleted content results in a
+// rest.NotFoundError.
+func DeleteContent(pubID string, ctx context.Context) rest.RestError {
+  return execTombstoneUpdate(contentSoftDeleteStmt, `delete`, pubID, ctx)
+}
+
+// RestoreContent restores soft deleted content. Attempting to restore content
+// not in the trash results in a rest.NotFoundError.
+func RestoreContent(pubID string, ctx context.Context) rest.RestError {
+  return execTombstoneUpdate(contentRestoreStmt, `restore`, pubID, ctx)
+}
+
+// execTombstoneUpdate deletes or restores the content and records a revision,
+// so that any ETag held for the content no longer matches.
+func execTombstoneUpdate(stmt *sql.Stmt, action string, pubID string, ctx context.Context) rest.RestError {
+  txn, err := sqldb.DB.Begin()
+  if err != nil {
+    return rest.ServerError(fmt.Sprintf(`Could not %s content '%s'. (txn error)`, action, pubID), err)
+  }
+
+  res, err := txn.Stmt(stmt).ExecContext(ctx, pubID)
+  if err != nil {
+    defer txn.Rollback()
+    return rest.ServerError(fmt.Sprintf(`Could not %s content '%s'.`, action, pubID), err)
+  }
+  if count, err := res.RowsAffected(); err != nil {
+    defer txn.Rollback()
+    return rest.ServerError(fmt.Sprintf(`Could not verify %s of content '%s'.`, action, pubID), err)
+  } else if count == 0 {
+    defer txn.Rollback()
+    return rest.NotFoundError(fmt.Sprintf(`No content '%s' to %s.`, pubID, action), nil)
+  }
+  if restErr := recordContentChangeInTxn(pubID, ctx, txn); restErr != nil {
+    return restErr // already rolled back
+  }
+  if err := txn.Commit(); err != nil {
+    return rest.ServerError(fmt.Sprintf(`Could not %s content '%s'. (commit error)`, action, pubID), err)
+  }
+  return nil
+}
+
+// PurgeContent permanently removes the content, whether or not it has been
+// soft deleted. This is an administrative function.
+func PurgeContent(pubID string, ctx context.Context) rest.RestError {
+  id, restErr := getIDByPubID(getContentIDByPubIDStmt, `Content`, pubID, ctx)
+  if restErr != nil {
+    return restErr
+  }
+
+  // Only assets have a blob; for anything else, there's no record and we fall
+  // back to the public ID, but deleting a non-existent blob is harmless.
+  var blobKey nulls.String
+  if err := getContentTypeAssetBlobKeyByIDStmt.QueryRowContext(ctx, id).Scan(&blobKey); err != nil && err != sql.ErrNoRows {
+    return rest.ServerError(fmt.Sprintf(`Could not purge content '%s'.`, pubID), err)
+  }
+
+  txn, err := sqldb.DB.Begin()
+  if err != nil {
+    return rest.ServerError("Could not purge content. (txn error)", err)
+  }
+  if restErr := PurgeContentByIDInTxn(id, ctx, txn); restErr != nil {
+    return restErr // already rolled back
+  }
+  if err := txn.Commit(); err != nil {
+    return rest.ServerError(fmt.Sprintf(`Could not purge content '%s'. (commit error)`, pubID), err)
+  }
+  if blobStore != nil {
+    if err := blobStore.Delete(ctx, assetBlobKey(pubID, blobKey)); err != nil {
+      log.Printf("Content '%s' purged, but could not delete blob: %v", pubID, err)
+    }
+  }
+  return nil
+}
+
+// PurgeContentByIDInTxn permanently removes the content by internal ID in the
+// context of an existing transaction. See PurgeContent.
+func PurgeContentByIDInTxn(id int64, ctx context.Context, txn *sql.Tx) rest.RestError {
+  for _, stmt := range []*sql.Stmt{
+      contentPurgeContributorsStmt,
+      contentPurgeTypeTextStmt,
+      contentPurgeTypeAssetStmt,
+      contentPurgeSummaryStmt,
+      contentPurgeEntityStmt } {
+    if _, err := txn.Stmt(stmt).ExecContext(ctx, id); err != nil {
+      defer txn.Rollback()
+      return rest.ServerError(`Could not purge content.`, err)
+    }
+  }
+  return nil
+}
@@ -0,0 +1,25 @@
+package content
+
+// statusError is a rest.RestError for HTTP statuses which go-rest provides no
+// constructor for, such as 412 Precondition Failed or 413 Payload Too Large.
+type statusError struct {
+  message string
+  code    int
+  cause   error
+}
+
+func newStatusError(code int, message string, cause error) *statusError {
+  return &statusError{ message: message, code: code, cause: cause }
+}
+
+func (e *statusError) Error() string {
+  return e.message
+}
+
+func (e *statusError) Code() int {
+  return e.code
+}
+
+func (e *statusError) Cause() error {
+  return e.cause
+}
@@ -0,0 +1,196 @@
+package content
+
+import (
+  "bytes"
+  "context"
+  "errors"
+  "fmt"
+  "io/ioutil"
+  "net/url"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "strings"
+
+  model "github.com/Liquid-Labs/catalyst-content-model/go/resources/content"
+)
+
+// gitSourceReader reads a git repository tree pinned to the commit resolved
+// from the configured ref (default 'HEAD') when the reader is created. The
+// 'repository' configuration may be an absolute path to a repository within
+// LocalDirRoot, which is read in place, or an 'https' or 'ssh' clone URL, which
+// is cloned to a temporary directory removed by Close. Requires the 'git'
+// executable.
+type gitSourceReader struct {
+  gitDir      string
+  cloneDir    string
+  contentPath string
+  commitSHA   string
+}
+
+// gitAllowedProtocols limits the transports git may use to clone. In
+// particular, this excludes local paths ('file'), which must go through
+// LocalDirRoot, and 'ext', which runs arbitrary commands.
+const gitAllowedProtocols = `https:ssh`
+
+func newGitSourceReader(cs *model.ContentSource, ctx context.Context) (*gitSourceReader, error) {
+  repository := cs.Config[`repository`]
+  if repository.IsEmpty() {
+    return nil, fmt.Errorf(`no 'repository' configuration found`)
+  }
+  ref := `HEAD`
+  if !cs.Config[`ref`].IsEmpty() {
+    ref = cs.Config[`ref`].String
+  }
+  // Would otherwise be taken as an option.
+  if strings.HasPrefix(ref, `-`) {
+    return nil, fmt.Errorf(`invalid ref '%s'`, ref)
+  }
+  // Errors from git may include the repository, and so any credentials in it.
+  redacted := redactRepositoryURL(repository.String)
+  redact := func(err error) error {
+    return errors.New(strings.Replace(err.Error(), repository.String, redacted, -1))
+  }
+
+  r := &gitSourceReader{ contentPath : contentPathPrefix(cs.Config[`contentPath`].String) }
+  if filepath.IsAbs(repository.String) {
+    gitDir, err := resolveLocalDir(repository.String)
+    if err != nil {
+      return nil, fmt.Errorf(`local repository not permitted: %v`, err)
+    }
+    r.gitDir = gitDir
+  } else {
+    cloneDir, err := ioutil.TempDir(``, `content-git-`)
+    if err != nil {
+      return nil, err
+    }
+    r.cloneDir, r.gitDir = cloneDir, cloneDir
+    if _, err := r.git(ctx, `clone`, `--bare`, `--quiet`, `--`, repository.String, cloneDir); err != nil {
+      r.Close()
+      return nil, fmt.Errorf(`could not clone '%s': %v`, redacted, redact(err))
+    }
+  }
+
+  commitSHA, err := r.git(ctx, `rev-parse`, `--verify`, `--quiet`, ref + `^{commit}`)
+  if err != nil {
+    r.Close()
+    return nil, fmt.Errorf(`could not resolve ref '%s' for '%s': %v`, ref, redacted, redact(err))
+  }
+  r.commitSHA = strings.TrimSpace(string(commitSHA))
+
+  return r, nil
+}
+
+// redactRepositoryURL removes any password or token from a repository URL. The
+// user name is kept, as it is commonly significant (e.g., 'git@').
+func redactRepositoryURL(repository string) string {
+  parsed, err := url.Parse(repository)
+  if err != nil || parsed.User == nil {
+    return repository
+  }
+  var userinfo string
+  if _, hasPassword := parsed.User.Password(); hasPassword {
+    userinfo = parsed.User.Username() + `:` + RedactedSecret
+  } else if parsed.Scheme == `https` && parsed.User.Username() != `` {
+    userinfo = RedactedSecret // e.g., 'https://<token>@github.com/...'
+  } else {
+    return repository
+  }
+  // Set by hand, as url.URL would escape the redaction marker.
+  parsed.User = nil
+  return strings.Replace(parsed.String(), `://`, `://` + userinfo + `@`, 1)
+}
+
+func (r *gitSourceReader) Version() string {
+  return r.commitSHA
+}
+
+// ListItems uses the blob SHAs from the tree as the version cookies.
+func (r *gitSourceReader) ListItems(ctx context.Context) (map[string]string, error) {
+  output, err := r.git(ctx, `ls-tree`, `-r`, `-z`, `--full-tree`, r.commitSHA)
+  if err != nil {
+    return nil, fmt.Errorf(`problem while listing tree for commit '%s': %v`, r.commitSHA, err)
+  }
+
+  items := make(map[string]string)
+  // Each entry is '<mode> SP <type> SP <object> TAB <path>'.
+  for _, entry := range strings.Split(string(output), "\x00") {
+    tab := strings.IndexByte(entry, '\t')
+    if tab == -1 {
+      continue
+    }
+    fields, path := strings.Fields(entry[:tab]), entry[tab + 1:]
+    if len(fields) == 3 && fields[1] == `blob` && strings.HasPrefix(path, r.contentPath) {
+      items[path] = fields[2]
+    }
+  }
+
+  return items, nil
+}
+
+// ReadItem streams the blob from git, giving up once it exceeds
+// maxSourceItemSize.
+func (r *gitSourceReader) ReadItem(ctx context.Context, externPath string) ([]byte, error) {
+  ctx, cancel := context.WithCancel(ctx)
+  defer cancel() // stops git if we give up early
+  cmd, stderr := r.command(ctx, `cat-file`, `blob`, r.commitSHA + `:` + externPath)
+  stdout, err := cmd.StdoutPipe()
+  if err != nil {
+    return nil, err
+  }
+  if err := cmd.Start(); err != nil {
+    return nil, fmt.Errorf(`problem while reading '%s' at commit '%s': %v`, externPath, r.commitSHA, err)
+  }
+
+  data, err := readLimited(stdout, maxSourceItemSize)
+  if err != nil {
+    cancel()
+    cmd.Wait()
+    return nil, fmt.Errorf(`problem while reading '%s' at commit '%s': %v`, externPath, r.commitSHA, err)
+  }
+  if err := cmd.Wait(); err != nil {
+    return nil, fmt.Errorf(`problem while reading '%s' at commit '%s': %v`, externPath, r.commitSHA, gitError(err, stderr))
+  }
+
+  return data, nil
+}
+
+// Close removes any temporary clone.
+func (r *gitSourceReader) Close() error {
+  if r.cloneDir == `` {
+    return nil
+  }
+  return os.RemoveAll(r.cloneDir)
+}
+
+func (r *gitSourceReader) git(ctx context.Context, args ...string) ([]byte, error) {
+  cmd, stderr := r.command(ctx, args...)
+  output, err := cmd.Output()
+  if err != nil {
+    return nil, gitError(err, stderr)
+  }
+
+  return output, nil
+}
+
+// command prepares git to run against the repository, capturing stderr in the
+// returned buffer.
+func (r *gitSourceReader) command(ctx context.Context, args ...string) (*exec.Cmd, *bytes.Buffer) {
+  if r.gitDir != `` {
+    args = append([]string{`-C`, r.gitDir}, args...)
+  }
+  cmd := exec.CommandContext(ctx, `git`, args...)
+  // Never wait on credential prompts.
+  cmd.Env = append(os.Environ(), `GIT_TERMINAL_PROMPT=0`, `GIT_ALLOW_PROTOCOL=` + gitAllowedProtocols)
+  var stderr bytes.Buffer
+  cmd.Stderr = &stderr
+  return cmd, &stderr
+}
+
+// gitError adds git's own message, if any, to the error.
+func gitError(err error, stderr *bytes.Buffer) error {
+  if message := strings.TrimSpace(stderr.String()); message != `` {
+    return fmt.Errorf(`%v: %s`, err, message)
+  }
+  return err
+}
@@ -0,0 +1,165 @@
+package content
+
+import (
+  "context"
+  "encoding/json"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "net/http"
+  "net/url"
+  "strings"
+
+  model "github.com/Liquid-Labs/catalyst-content-model/go/resources/content"
+)
+
+const defaultGithubAPIURL = `https://api.github.com`
+
+// githubSourceReader reads a GitHub repository tree pinned to the commit at the
+// head of the configured ref (default: the repository's default branch) when
+// the reader is created. The 'apiURL' configuration may be used to point at
+// GitHub Enterprise; it is subject to the same address checks as URL content.
+// See AllowPrivateURLs.
+type githubSourceReader struct {
+  client      *http.Client
+  apiURL      string
+  owner       string
+  repo        string
+  token       string
+  contentPath string
+  commitSHA   string
+}
+
+func newGithubSourceReader(cs *model.ContentSource, ctx context.Context) (*githubSourceReader, error) {
+  owner, repo := cs.Config[`owner`], cs.Config[`repo`]
+  if owner.IsEmpty() || repo.IsEmpty() {
+    return nil, fmt.Errorf(`'owner' and 'repo' configuration required`)
+  }
+  apiURL := defaultGithubAPIURL
+  if !cs.Config[`apiURL`].IsEmpty() {
+    apiURL = strings.TrimSuffix(cs.Config[`apiURL`].String, `/`)
+    if _, err := checkSourceAPIURL(apiURL); err != nil {
+      return nil, fmt.Errorf(`'apiURL' not permitted: %v`, err)
+    }
+  }
+
+  r := &githubSourceReader{
+    client      : sourceAPIClient,
+    apiURL      : apiURL,
+    owner       : owner.String,
+    repo        : repo.String,
+    token       : cs.Config[`apiToken`].String,
+    contentPath : contentPathPrefix(cs.Config[`contentPath`].String),
+  }
+
+  ref := cs.Config[`ref`].String
+  if ref == `` {
+    var repository struct {
+      DefaultBranch string `json:"default_branch"`
+    }
+    if err := r.getJSON(ctx, ``, &repository); err != nil {
+      return nil, fmt.Errorf(`could not retrieve default branch for '%s/%s': %v`, r.owner, r.repo, err)
+    }
+    if repository.DefaultBranch == `` {
+      return nil, fmt.Errorf(`repository '%s/%s' has no default branch`, r.owner, r.repo)
+    }
+    ref = repository.DefaultBranch
+  }
+
+  var commit struct {
+    SHA string `json:"sha"`
+  }
+  if err := r.getJSON(ctx, `/commits/` + url.PathEscape(ref), &commit); err != nil {
+    return nil, fmt.Errorf(`could not resolve ref '%s' for '%s/%s': %v`, ref, r.owner, r.repo, err)
+  }
+  r.commitSHA = commit.SHA
+
+  return r, nil
+}
+
+func (r *githubSourceReader) Version() string {
+  return r.commitSHA
+}
+
+// ListItems uses the blob SHAs from the tree as the version cookies.
+func (r *githubSourceReader) ListItems(ctx context.Context) (map[string]string, error) {
+  var tree struct {
+    Tree []struct {
+      Path string `json:"path"`
+      Type string `json:"type"`
+      SHA  string `json:"sha"`
+    } `json:"tree"`
+    Truncated bool `json:"truncated"`
+  }
+  if err := r.getJSON(ctx, `/git/trees/` + r.commitSHA + `?recursive=1`, &tree); err != nil {
+    return nil, fmt.Errorf(`problem while retrieving GitHub tree for '%s/%s': %v`, r.owner, r.repo, err)
+  }
+  // A partial listing would cause us to remove content which still exists.
+  if tree.Truncated {
+    return nil, fmt.Errorf(`GitHub tree for '%s/%s' is too large to list`, r.owner, r.repo)
+  }
+
+  items := make(map[string]string)
+  for _, node := range tree.Tree {
+    if node.Type == `blob` && strings.HasPrefix(node.Path, r.contentPath) {
+      items[node.Path] = node.SHA
+    }
+  }
+
+  return items, nil
+}
+
+func (r *githubSourceReader) ReadItem(ctx context.Context, externPath string) ([]byte, error) {
+  escapedPath := make([]string, 0)
+  for _, segment := range strings.Split(externPath, `/`) {
+    escapedPath = append(escapedPath, url.PathEscape(segment))
+  }
+
+  response, err := r.get(ctx, `/contents/` + strings.Join(escapedPath, `/`) + `?ref=` + r.commitSHA, `application/vnd.github.v3.raw`)
+  if err != nil {
+    return nil, fmt.Errorf(`problem while retrieving GitHub file '%s' for '%s/%s': %v`, externPath, r.owner, r.repo, err)
+  }
+  defer response.Body.Close()
+
+  return readLimited(response.Body, maxSourceItemSize)
+}
+
+// get issues a GET against the repository API. Non-200 responses result in an
+// error.
+func (r *githubSourceReader) get(ctx context.Context, repoPath string, accept string) (*http.Response, error) {
+  request, err := http.NewRequest(`GET`, r.apiURL + `/repos/` + url.PathEscape(r.owner) + `/` + url.PathEscape(r.repo) + repoPath, nil)
+  if err != nil {
+    return nil, err
+  }
+  request = request.WithContext(ctx)
+  request.Header.Set(`Accept`, accept)
+  if r.token != `` {
+    request.Header.Set(`Authorization`, `token ` + r.token)
+  }
+
+  response, err := r.client.Do(request)
+  if err != nil {
+    return nil, err
+  }
+  if response.StatusCode != http.StatusOK {
+    defer response.Body.Close()
+    message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 512))
+    return nil, fmt.Errorf(`GitHub responded '%s': %s`, response.Status, message)
+  }
+
+  return response, nil
+}
+
+func (r *githubSourceReader) getJSON(ctx context.Context, repoPath string, result interface{}) error {
+  response, err := r.get(ctx, repoPath, `application/vnd.github.v3+json`)
+  if err != nil {
+    return err
+  }
+  defer response.Body.Close()
+
+  body, err := readLimited(response.Body, maxSourceListingSize)
+  if err != nil {
+    return err
+  }
+  return json.Unmarshal(body, result)
+}
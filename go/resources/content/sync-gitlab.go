@@ -0,0 +1,252 @@
+package content
+
+import (
+  "context"
+  "crypto/subtle"
+  "fmt"
+  "log"
+  "net/http"
+  "strings"
+
+  "github.com/Liquid-Labs/go-rest/rest"
+  "github.com/xanzy/go-gitlab"
+
+  model "github.com/Liquid-Labs/catalyst-content-model/go/resources/content"
+)
+
+// gitlabSourceReader reads a GitLab repository tree pinned to the commit at
+// the head of the configured ref (default 'master') when the reader is
+// created. Requests use sourceAPIClient, so the API host must resolve to a
+// public address, and each response, including a raw file, is limited to
+// maxSourceItemSize.
+type gitlabSourceReader struct {
+  git         *gitlab.Client
+  apiHost     string
+  projectID   string
+  contentPath string
+  commitID    string
+}
+
+func newGitlabSourceReader(cs *model.ContentSource) (*gitlabSourceReader, error) {
+  return newGitlabSourceReaderAt(cs, ``)
+}
+
+// newGitlabSourceReaderAt creates a reader pinned to the given commit, or to
+// the head of the configured ref if the commit is empty.
+func newGitlabSourceReaderAt(cs *model.ContentSource, commitID string) (*gitlabSourceReader, error) {
+  apiHost := cs.Config[`apiHost`]
+  if apiHost.IsEmpty() {
+    return nil, fmt.Errorf(`no 'apiHost' configuration found`)
+  }
+  projectID := cs.Config[`projectID`]
+  if projectID.IsEmpty() {
+    return nil, fmt.Errorf(`no 'projectID' configuration found`)
+  }
+  ref := `master`
+  if !cs.Config[`ref`].IsEmpty() {
+    ref = cs.Config[`ref`].String
+  }
+
+  apiURL, err := checkSourceAPIURL(`https://` + apiHost.String + `/api/v4`)
+  if err == nil && apiURL.Host != apiHost.String {
+    err = fmt.Errorf(`invalid host '%s'`, apiHost.String)
+  }
+  if err != nil {
+    return nil, fmt.Errorf(`'apiHost' not permitted: %v`, err)
+  }
+
+  git := gitlab.NewClient(limitedBodyClient(sourceAPIClient, maxSourceItemSize), cs.Config[`apiToken`].String)
+  if err := git.SetBaseURL(apiURL.String()); err != nil {
+    return nil, err
+  }
+
+  if commitID == `` {
+    branch, _, err := git.Branches.GetBranch(projectID.String, ref)
+    if err != nil {
+      return nil, fmt.Errorf(`could not resolve ref '%s' for project '%s' from '%s': %v`, ref, projectID.String, apiHost.String, err)
+    }
+    commitID = branch.Commit.ID
+  }
+
+  return &gitlabSourceReader{
+    git         : git,
+    apiHost     : apiHost.String,
+    projectID   : projectID.String,
+    contentPath : contentPathPrefix(cs.Config[`contentPath`].String),
+    commitID    : commitID,
+  }, nil
+}
+
+func (r *gitlabSourceReader) Version() string {
+  return r.commitID
+}
+
+// ListItems uses the blob IDs from the tree as the version cookies. A blob ID
+// changes exactly when the file content does, so there's no need to retrieve
+// per-file commit metadata.
+func (r *gitlabSourceReader) ListItems(ctx context.Context) (map[string]string, error) {
+  recursive := true
+  listTreeOptions := &gitlab.ListTreeOptions{
+    ListOptions : gitlab.ListOptions{ Page: 1, PerPage: 100 },
+    Ref         : &r.commitID,
+    Recursive   : &recursive,
+  }
+  if r.contentPath != `` {
+    treePath := strings.TrimSuffix(r.contentPath, `/`)
+    listTreeOptions.Path = &treePath
+  }
+
+  items := make(map[string]string)
+  for {
+    treeNodes, response, err := r.git.Repositories.ListTree(r.projectID, listTreeOptions)
+    if err != nil {
+      return nil, fmt.Errorf(`problem while retrieving GitLab tree for project '%s' from '%s': %v`, r.projectID, r.apiHost, err)
+    }
+
+    for _, treeNode := range treeNodes {
+      if treeNode.Type == `blob` && strings.HasPrefix(treeNode.Path, r.contentPath) {
+        items[treeNode.Path] = treeNode.ID
+      }
+    }
+
+    if response.NextPage == 0 {
+      break
+    }
+    listTreeOptions.Page = response.NextPage
+  }
+
+  return items, nil
+}
+
+func (r *gitlabSourceReader) ReadItem(ctx context.Context, externPath string) ([]byte, error) {
+  body, _, err := r.git.RepositoryFiles.GetRawFile(r.projectID, externPath, &gitlab.GetRawFileOptions{ Ref: &r.commitID })
+  if err != nil {
+    return nil, fmt.Errorf(`problem while retrieving GitLab file '%s' for project '%s' from '%s': %v`, externPath, r.projectID, r.apiHost, err)
+  }
+  return body, nil
+}
+
+// ItemVersion retrieves the blob ID of a single item.
+func (r *gitlabSourceReader) ItemVersion(ctx context.Context, externPath string) (string, error) {
+  file, response, err := r.git.RepositoryFiles.GetFileMetaData(r.projectID, externPath, &gitlab.GetFileMetaDataOptions{ Ref: &r.commitID })
+  if response != nil && response.StatusCode == http.StatusNotFound {
+    return ``, errItemNotFound
+  } else if err != nil {
+    return ``, fmt.Errorf(`problem while retrieving GitLab file metadata '%s' for project '%s' from '%s': %v`, externPath, r.projectID, r.apiHost, err)
+  }
+  return file.BlobID, nil
+}
+
+// maxGitlabPushEventSize limits the size of a GitLab push webhook request. An
+// event lists at most 20 commits.
+const maxGitlabPushEventSize = 4 << 20 // 4MiB
+
+// GitlabPushEvent is the subset of the GitLab push event payload used for
+// incremental sync.
+type GitlabPushEvent struct {
+  ObjectKind        string              `json:"object_kind"`
+  Ref               string              `json:"ref"`
+  Before            string              `json:"before"`
+  After             string              `json:"after"`
+  TotalCommitsCount int                 `json:"total_commits_count"`
+  Commits           []*GitlabPushCommit `json:"commits"`
+}
+
+type GitlabPushCommit struct {
+  ID       string   `json:"id"`
+  Added    []string `json:"added"`
+  Modified []string `json:"modified"`
+  Removed  []string `json:"removed"`
+}
+
+// VerifyGitlabWebhookToken checks the 'X-Gitlab-Token' value against the
+// 'webhookToken' configured for the source. Sources without a webhook token do
+// not accept webhooks.
+func VerifyGitlabWebhookToken(cs *model.ContentSource, token string, ctx context.Context) rest.RestError {
+  if cs.SourceType.String != `GITLAB` || cs.Config[`webhookToken`].IsEmpty() {
+    return rest.AuthorizationError(`Content source does not accept GitLab webhooks.`, nil)
+  }
+  cs, restErr := withContentSourceSecrets(cs, ctx)
+  if restErr != nil {
+    return restErr
+  }
+  if subtle.ConstantTimeCompare([]byte(token), []byte(cs.Config[`webhookToken`].String)) != 1 {
+    return rest.AuthorizationError(`Invalid GitLab webhook token.`, nil)
+  }
+  return nil
+}
+
+// SyncGitlabPush incrementally syncs the files under the content path touched
+// by the push. Pushes to other refs are ignored. The push is applied alone only
+// if it follows on from the version last synced in full; otherwise, such as
+// when an earlier push was missed or failed, or when the push has more commits
+// than the event lists (GitLab lists at most 20), the source is fully synced at
+// the head of the branch. Shares the per-source lock with SyncContentSource.
+func SyncGitlabPush(cs *model.ContentSource, event *GitlabPushEvent, ctx context.Context) (*SyncSummary, rest.RestError) {
+  if event.ObjectKind != `push` {
+    return nil, rest.BadRequestError(fmt.Sprintf(`Unsupported GitLab event '%s'.`, event.ObjectKind), nil)
+  }
+
+  ref := `master`
+  if !cs.Config[`ref`].IsEmpty() {
+    ref = cs.Config[`ref`].String
+  }
+  // A deleted branch has an 'after' of all zeros.
+  if event.Ref != `refs/heads/` + ref || strings.Trim(event.After, `0`) == `` {
+    return &SyncSummary{ Source: cs.Name.String, Failures: make([]*SyncFailure, 0) }, nil
+  }
+
+  unlock, restErr := lockContentSource(cs, ctx)
+  if restErr != nil {
+    return nil, restErr
+  }
+  defer unlock()
+
+  incremental := event.TotalCommitsCount <= len(event.Commits)
+  if incremental {
+    lastVersion, err := lastSyncedVersion(cs, ctx)
+    if err != nil {
+      log.Printf(`Could not determine last synced version of content source '%s'; syncing in full: %v`, cs.Name.String, err)
+    }
+    incremental = err == nil && lastVersion != `` && lastVersion == event.Before
+  }
+
+  return recordSyncRun(cs, SyncTriggerWebhook, ctx, func(ctx context.Context) (*SyncSummary, rest.RestError) {
+    if !incremental {
+      return syncContentSource(cs, ctx)
+    }
+    decrypted, restErr := withContentSourceSecrets(cs, ctx)
+    if restErr != nil {
+      return nil, restErr
+    }
+    return syncGitlabPush(decrypted, event, ctx)
+  })
+}
+
+func syncGitlabPush(cs *model.ContentSource, event *GitlabPushEvent, ctx context.Context) (*SyncSummary, rest.RestError) {
+  summary := &SyncSummary{ Source: cs.Name.String, Failures: make([]*SyncFailure, 0) }
+
+  contentPath := contentPathPrefix(cs.Config[`contentPath`].String)
+  touched := make(map[string]bool)
+  externPaths := make([]string, 0)
+  for _, commit := range event.Commits {
+    for _, changes := range [][]string{commit.Added, commit.Modified, commit.Removed} {
+      for _, externPath := range changes {
+        if strings.HasPrefix(externPath, contentPath) && !touched[externPath] {
+          touched[externPath] = true
+          externPaths = append(externPaths, externPath)
+        }
+      }
+    }
+  }
+
+  reader, err := newGitlabSourceReaderAt(cs, event.After)
+  if err != nil {
+    return nil, rest.ServerError(fmt.Sprintf(`Failed to sync GITLAB source '%s'.`, cs.Name.String), err)
+  }
+  if restErr := reconcileContentSourceItems(cs, reader, externPaths, summary, ctx); restErr != nil {
+    return nil, restErr
+  }
+
+  return summary, nil
+}
@@ -0,0 +1,182 @@
+package content
+
+import (
+  "context"
+  "database/sql/driver"
+  "encoding/json"
+  "net"
+  "net/http"
+  "net/http/httptest"
+  "reflect"
+  "strings"
+  "testing"
+  "time"
+
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/Liquid-Labs/go-rest/rest"
+
+  model "github.com/Liquid-Labs/catalyst-content-model/go/resources/content"
+)
+
+const gitlabTestCommit = `9a0364b9e99bb480dd25e1f0284c8555d4a3c6bb`
+
+// newGitlabTestServer stands in for the GitLab API for project 42, whose
+// 'master' branch is at gitlabTestCommit. The returned function closes the
+// server and restores sourceAPIClient.
+func newGitlabTestServer(t *testing.T) (*httptest.Server, func()) {
+  writeJSON := func(w http.ResponseWriter, v interface{}) {
+    w.Header().Set(`Content-Type`, `application/json`)
+    json.NewEncoder(w).Encode(v)
+  }
+  mux := http.NewServeMux()
+  mux.HandleFunc(`/api/v4/projects/42/repository/branches/master`, func(w http.ResponseWriter, r *http.Request) {
+    writeJSON(w, map[string]interface{}{ `name`: `master`, `commit`: map[string]string{ `id`: gitlabTestCommit } })
+  })
+  mux.HandleFunc(`/api/v4/projects/42/repository/tree`, func(w http.ResponseWriter, r *http.Request) {
+    if ref := r.URL.Query().Get(`ref`); ref != gitlabTestCommit {
+      t.Errorf(`tree requested at ref '%s'; expected the pinned commit`, ref)
+    }
+    writeJSON(w, []map[string]string{
+      { `id`: `readme-blob`, `type`: `blob`, `path`: `README.md` },
+      { `id`: `docs-tree`, `type`: `tree`, `path`: `docs` },
+      { `id`: `a-blob`, `type`: `blob`, `path`: `docs/a.md` },
+      { `id`: `big-blob`, `type`: `blob`, `path`: `docs/big.md` },
+    })
+  })
+  mux.HandleFunc(`/api/v4/projects/42/repository/files/docs%2Fa.md/raw`, func(w http.ResponseWriter, r *http.Request) {
+    w.Write([]byte(`# A`))
+  })
+  mux.HandleFunc(`/api/v4/projects/42/repository/files/docs%2Fbig.md/raw`, func(w http.ResponseWriter, r *http.Request) {
+    w.Write([]byte(strings.Repeat(`x`, maxSourceItemSize + 1)))
+  })
+  server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    // The client escapes file paths; match on the raw path.
+    r.URL.Path = r.URL.EscapedPath()
+    mux.ServeHTTP(w, r)
+  }))
+
+  // The test server listens on loopback with its own certificate.
+  previous := sourceAPIClient
+  sourceAPIClient = server.Client()
+  return server, func() {
+    sourceAPIClient = previous
+    server.Close()
+  }
+}
+
+func gitlabTestSource(apiHost string) *model.ContentSource {
+  cs := &model.ContentSource{ SourceType: nulls.NewString(`GITLAB`), Name: nulls.NewString(`site`) }
+  cs.Config = map[string]nulls.String{
+    `apiHost`     : nulls.NewString(apiHost),
+    `projectID`   : nulls.NewString(`42`),
+    `contentPath` : nulls.NewString(`docs/`),
+  }
+  return cs
+}
+
+func TestGitlabSourceReaderReconcile(t *testing.T) {
+  server, restore := newGitlabTestServer(t)
+  defer restore()
+  ctx := context.Background()
+
+  reader, err := newGitlabSourceReader(gitlabTestSource(strings.TrimPrefix(server.URL, `https://`)))
+  if err != nil {
+    t.Fatalf(`could not create reader: %v`, err)
+  }
+  if reader.Version() != gitlabTestCommit {
+    t.Errorf(`version is '%s'; expected '%s'`, reader.Version(), gitlabTestCommit)
+  }
+  items, err := reader.ListItems(ctx)
+  if err != nil {
+    t.Fatalf(`could not list items: %v`, err)
+  }
+  expectedItems := map[string]string{ `docs/a.md`: `a-blob`, `docs/big.md`: `big-blob` }
+  if !reflect.DeepEqual(items, expectedItems) {
+    t.Errorf(`listed %v; expected %v`, items, expectedItems)
+  }
+  if body, err := reader.ReadItem(ctx, `docs/a.md`); err != nil || string(body) != `# A` {
+    t.Errorf(`read '%s' (%v)`, body, err)
+  }
+  if _, err := reader.ReadItem(ctx, `docs/big.md`); err == nil {
+    t.Errorf(`expected error reading item over the size limit`)
+  }
+}
+
+func TestGitlabSourceReaderRefusesAPIHost(t *testing.T) {
+  for _, apiHost := range []string{
+    `127.0.0.1:1`, // private address, refused on connection
+    `user:pass@gitlab.example.com`,
+    `gitlab.example.com/evil`,
+    `gitlab.example.com?x=`,
+  } {
+    if _, err := newGitlabSourceReader(gitlabTestSource(apiHost)); err == nil {
+      t.Errorf(`expected '%s' to be refused`, apiHost)
+    }
+  }
+}
+
+func TestSyncGitlabPushReleasesLockWhenGitlabHangs(t *testing.T) {
+  // Accepts connections, holding them open until the listener closes, but
+  // never answers.
+  listener, err := net.Listen(`tcp`, `127.0.0.1:0`)
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer listener.Close()
+  go func() {
+    for {
+      conn, err := listener.Accept()
+      if err != nil {
+        return
+      }
+      defer conn.Close()
+    }
+  }()
+  // Stands in for sourceAPIClient, whose timeouts are too long to wait on, and
+  // permits the loopback address.
+  previous := sourceAPIClient
+  sourceAPIClient = &http.Client{ Timeout: 100 * time.Millisecond }
+  defer func() { sourceAPIClient = previous }()
+
+  noRows := func(columns int) fakeQueryHandler {
+    return func(args []driver.Value) ([]string, [][]driver.Value, error) {
+      return fakeColumns(columns), nil, nil
+    }
+  }
+  defer useFakeDB(t, map[string]fakeQueryHandler{
+    getLastSyncRunQuery          : noRows(2),
+    createSyncRunQuery           : fakeExec,
+    finishSyncRunQuery           : fakeExec,
+    listContentSourceConfigQuery : noRows(2),
+  })()
+
+  cs := gitlabTestSource(listener.Addr().String())
+  cs.Id = nulls.NewInt64(1)
+  cs.PubId = nulls.NewString(`0f7d1b8e-5d3a-4c0e-9a53-9a0c4f2f3b11`)
+  event := &GitlabPushEvent{
+    ObjectKind        : `push`,
+    Ref               : `refs/heads/master`,
+    Before            : strings.Repeat(`1`, 40),
+    After             : strings.Repeat(`2`, 40),
+    TotalCommitsCount : 1,
+    Commits           : []*GitlabPushCommit{{ ID: strings.Repeat(`2`, 40), Added: []string{`docs/a.md`} }},
+  }
+
+  // Each push falls back to a full sync, which stalls resolving the branch. The
+  // second push can only proceed once the first releases the source lock.
+  for i := 0; i < 2; i++ {
+    done := make(chan rest.RestError, 1)
+    go func() {
+      _, restErr := SyncGitlabPush(cs, event, context.Background())
+      done <- restErr
+    }()
+    select {
+    case restErr := <-done:
+      if restErr == nil {
+        t.Errorf(`push %d: expected the hung sync to fail`, i + 1)
+      }
+    case <-time.After(5 * time.Second):
+      t.Fatalf(`push %d: sync still running; GitLab calls are not bounded`, i + 1)
+    }
+  }
+}
@@ -0,0 +1,152 @@
+package content
+
+import (
+  "context"
+  "crypto/sha256"
+  "fmt"
+  "io"
+  "os"
+  "path"
+  "path/filepath"
+  "strings"
+  "time"
+
+  model "github.com/Liquid-Labs/catalyst-content-model/go/resources/content"
+)
+
+// LocalDirRoot limits LOCAL_DIR content sources, and GIT content sources read
+// from a local repository, to directories at or beneath the root. Both are
+// disabled while the root is empty.
+var LocalDirRoot = ``
+
+// resolveLocalDir verifies the directory lies within LocalDirRoot and returns
+// the resolved path.
+func resolveLocalDir(directory string) (string, error) {
+  if LocalDirRoot == `` {
+    return ``, fmt.Errorf(`local content sources are not enabled`)
+  }
+  root, err := filepath.EvalSymlinks(LocalDirRoot)
+  if err != nil {
+    return ``, err
+  }
+  resolved, err := filepath.EvalSymlinks(directory)
+  if err != nil {
+    return ``, err
+  }
+  if relPath, err := filepath.Rel(root, resolved); err != nil || relPath == `..` || strings.HasPrefix(relPath, `..` + string(filepath.Separator)) {
+    return ``, fmt.Errorf(`'%s' is not within the local directory root`, directory)
+  }
+  if info, err := os.Stat(resolved); err != nil {
+    return ``, err
+  } else if !info.IsDir() {
+    return ``, fmt.Errorf(`'%s' is not a directory`, directory)
+  }
+
+  return resolved, nil
+}
+
+// localDirSourceReader reads the files under a directory on the server
+// filesystem. The extern path of each item is the slash-separated file path
+// relative to the directory. Hidden files and directories are ignored.
+//
+// Unlike repository sources, a directory cannot be pinned; a file changed
+// between listing and reading will be refreshed on the next sync, as the stored
+// version cookie will no longer match.
+type localDirSourceReader struct {
+  directory   string
+  contentPath string
+  createdAt   time.Time
+}
+
+func newLocalDirSourceReader(cs *model.ContentSource) (*localDirSourceReader, error) {
+  directory := cs.Config[`directory`]
+  if directory.IsEmpty() {
+    return nil, fmt.Errorf(`no 'directory' configuration found`)
+  }
+  resolved, err := resolveLocalDir(directory.String)
+  if err != nil {
+    return nil, err
+  }
+
+  return &localDirSourceReader{
+    directory   : resolved,
+    contentPath : contentPathPrefix(cs.Config[`contentPath`].String),
+    createdAt   : time.Now(),
+  }, nil
+}
+
+// Version reports the time the reader was created.
+func (r *localDirSourceReader) Version() string {
+  return r.createdAt.UTC().Format(time.RFC3339)
+}
+
+// ListItems uses the file modification time and content hash as the version
+// cookie.
+func (r *localDirSourceReader) ListItems(ctx context.Context) (map[string]string, error) {
+  items := make(map[string]string)
+  err := filepath.Walk(r.directory, func(filePath string, info os.FileInfo, err error) error {
+    if err != nil {
+      return err
+    }
+    if err := ctx.Err(); err != nil {
+      return err
+    }
+    if filePath != r.directory && strings.HasPrefix(info.Name(), `.`) {
+      if info.IsDir() {
+        return filepath.SkipDir
+      }
+      return nil
+    }
+    if !info.Mode().IsRegular() {
+      return nil
+    }
+
+    relPath, err := filepath.Rel(r.directory, filePath)
+    if err != nil {
+      return err
+    }
+    externPath := filepath.ToSlash(relPath)
+    if !strings.HasPrefix(externPath, r.contentPath) {
+      return nil
+    }
+
+    hash, err := hashFile(filePath)
+    if err != nil {
+      return err
+    }
+    items[externPath] = fmt.Sprintf(`%d-%x`, info.ModTime().UnixNano(), hash)
+
+    return nil
+  })
+  if err != nil {
+    return nil, fmt.Errorf(`problem while listing '%s': %v`, r.directory, err)
+  }
+
+  return items, nil
+}
+
+func (r *localDirSourceReader) ReadItem(ctx context.Context, externPath string) ([]byte, error) {
+  // Cleaning against the root keeps the path within the directory.
+  filePath := filepath.Join(r.directory, filepath.FromSlash(path.Clean(`/` + externPath)))
+  file, err := os.Open(filePath)
+  if err != nil {
+    return nil, err
+  }
+  defer file.Close()
+
+  return readLimited(file, maxSourceItemSize)
+}
+
+func hashFile(filePath string) ([]byte, error) {
+  file, err := os.Open(filePath)
+  if err != nil {
+    return nil, err
+  }
+  defer file.Close()
+
+  hash := sha256.New()
+  if _, err := io.Copy(hash, file); err != nil {
+    return nil, err
+  }
+  return hash.Sum(nil), nil
+}
@@ -0,0 +1,43 @@
+package content
+
+import (
+  "context"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+
+  model "github.com/Liquid-Labs/catalyst-content-model/go/resources/content"
+)
+
+func TestLocalDirSourceReaderRefusesOversizeItem(t *testing.T) {
+  root := t.TempDir()
+  previousRoot := LocalDirRoot
+  LocalDirRoot = root
+  defer func() { LocalDirRoot = previousRoot }()
+  if err := os.MkdirAll(filepath.Join(root, `site`, `docs`), 0755); err != nil {
+    t.Fatal(err)
+  }
+  for name, content := range map[string]string{ `a.md`: `# A`, `big.md`: strings.Repeat(`x`, maxSourceItemSize + 1) } {
+    if err := ioutil.WriteFile(filepath.Join(root, `site`, `docs`, name), []byte(content), 0644); err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  cs := &model.ContentSource{ SourceType: nulls.NewString(`LOCAL_DIR`), Name: nulls.NewString(`site`) }
+  cs.Config = map[string]nulls.String{ `directory`: nulls.NewString(filepath.Join(root, `site`)) }
+  reader, err := newLocalDirSourceReader(cs)
+  if err != nil {
+    t.Fatalf(`could not create reader: %v`, err)
+  }
+  ctx := context.Background()
+  if _, err := reader.ReadItem(ctx, `docs/big.md`); err == nil {
+    t.Errorf(`expected error reading item over the size limit`)
+  }
+  if body, err := reader.ReadItem(ctx, `docs/a.md`); err != nil || string(body) != `# A` {
+    t.Errorf(`read '%s' (%v)`, body, err)
+  }
+}
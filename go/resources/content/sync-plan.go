@@ -0,0 +1,186 @@
+package content
+
+import (
+  "context"
+  "fmt"
+  "io"
+  "sort"
+
+  "github.com/Liquid-Labs/go-rest/rest"
+
+  model "github.com/Liquid-Labs/catalyst-content-model/go/resources/content"
+)
+
+// SyncPlan describes the changes a sync of the content source would make.
+// Items which cannot be read or parsed are listed as failures rather than
+// planned changes.
+type SyncPlan struct {
+  Source         string               `json:"source"`
+  Version        string               `json:"version"`
+  Create         []*SyncPlanItem      `json:"create"`
+  Update         []*SyncPlanItem      `json:"update"`
+  Delete         []*SyncPlanItem      `json:"delete"`
+  SlugCollisions []*SyncSlugCollision `json:"slugCollisions"`
+  Failures       []*SyncFailure       `json:"failures"`
+}
+
+// SyncPlanItem describes the planned change to a single item. The title and
+// slug are the values after the change; for updates, they are given only when
+// changed by front matter. Updates also carry the new text along with the
+// current title, slug, and text so the change can be reviewed.
+type SyncPlanItem struct {
+  ExternPath         string `json:"externPath"`
+  PubID              string `json:"pubId,omitempty"`
+  Title              string `json:"title,omitempty"`
+  Slug               string `json:"slug,omitempty"`
+  Text               string `json:"text,omitempty"`
+  PriorTitle         string `json:"priorTitle,omitempty"`
+  PriorSlug          string `json:"priorSlug,omitempty"`
+  PriorText          string `json:"priorText,omitempty"`
+  VersionCookie      string `json:"versionCookie,omitempty"`
+  PriorVersionCookie string `json:"priorVersionCookie,omitempty"`
+}
+
+// SyncSlugCollision lists the items, by extern path, and local content, by
+// public ID, which would share a slug after the sync.
+type SyncSlugCollision struct {
+  Slug        string   `json:"slug"`
+  ExternPaths []string `json:"externPaths"`
+  PubIDs      []string `json:"pubIds"`
+}
+
+// PlanContentSource determines the changes SyncContentSource would make without
+// writing to the database. Each new or changed item is read in order to apply
+// any front matter and check the resulting slugs.
+func PlanContentSource(cs *model.ContentSource, ctx context.Context) (*SyncPlan, rest.RestError) {
+  reader, restErr := newContentSourceReader(cs, ctx)
+  if restErr != nil {
+    return nil, restErr
+  }
+  if closer, ok := reader.(io.Closer); ok {
+    defer closer.Close()
+  }
+
+  items, err := reader.ListItems(ctx)
+  if err != nil {
+    return nil, rest.ServerError(fmt.Sprintf(`Problem listing items for content source '%s'.`, cs.Name.String), err)
+  }
+  records, err := listSyncedContent(cs.Name.String, cs.SourceType.String, ctx)
+  if err != nil {
+    return nil, rest.ServerError(`Problem while gathering current records.`, err)
+  }
+  // Slugs are unique across the namespace, whatever the source of the content.
+  namespaceRecords, err := listNamespaceContent(cs.Name.String, ctx)
+  if err != nil {
+    return nil, rest.ServerError(`Problem while gathering current records.`, err)
+  }
+
+  plan := &SyncPlan{
+    Source         : cs.Name.String,
+    Version        : reader.Version(),
+    Create         : make([]*SyncPlanItem, 0),
+    Update         : make([]*SyncPlanItem, 0),
+    Delete         : make([]*SyncPlanItem, 0),
+    SlugCollisions : make([]*SyncSlugCollision, 0),
+    Failures       : make([]*SyncFailure, 0),
+  }
+  // Track the slug each live record will have after the sync. Records from the
+  // source are identified by extern path and others by public ID.
+  fromSource := make(map[int64]bool)
+  recordsByID := make(map[int64]*syncedContent)
+  for _, record := range records {
+    fromSource[record.ID] = true
+    recordsByID[record.ID] = record
+  }
+  slugs := make(map[int64]string)
+  for _, record := range namespaceRecords {
+    slugs[record.ID] = record.Slug
+    recordsByID[record.ID] = record
+  }
+  createSlugs := make(map[string]string)
+
+  creates, updates, deletes := diffContentSource(items, records)
+  for _, change := range deletes {
+    delete(slugs, change.record.ID)
+    plan.Delete = append(plan.Delete, &SyncPlanItem{
+      ExternPath         : change.externPath,
+      PubID              : change.record.PubID,
+      PriorVersionCookie : change.record.VersionCookie,
+    })
+  }
+  for _, change := range updates {
+    c, restErr := readSyncedUpdate(change.record, change.versionCookie, reader, ctx)
+    if restErr != nil {
+      plan.Failures = append(plan.Failures, &SyncFailure{ ExternPath: change.externPath, Message: restErr.Error() })
+      continue
+    }
+    prior, restErr := GetContentTypeTextByID(change.record.ID, ctx)
+    if restErr != nil {
+      plan.Failures = append(plan.Failures, &SyncFailure{ ExternPath: change.externPath, Message: restErr.Error() })
+      continue
+    }
+    if c.Slug.IsValid() {
+      slugs[change.record.ID] = c.Slug.String
+    }
+    plan.Update = append(plan.Update, &SyncPlanItem{
+      ExternPath         : change.externPath,
+      PubID              : change.record.PubID,
+      Title              : c.Title.String,
+      Slug               : c.Slug.String,
+      Text               : c.Text.String,
+      PriorTitle         : prior.Title.String,
+      PriorSlug          : prior.Slug.String,
+      PriorText          : prior.Text.String,
+      VersionCookie      : change.versionCookie,
+      PriorVersionCookie : change.record.VersionCookie,
+    })
+  }
+  for _, change := range creates {
+    c, restErr := readSyncedContent(cs, change.externPath, change.versionCookie, reader, ctx)
+    if restErr != nil {
+      plan.Failures = append(plan.Failures, &SyncFailure{ ExternPath: change.externPath, Message: restErr.Error() })
+      continue
+    }
+    createSlugs[change.externPath] = c.Slug.String
+    plan.Create = append(plan.Create, &SyncPlanItem{
+      ExternPath    : change.externPath,
+      Title         : c.Title.String,
+      Slug          : c.Slug.String,
+      VersionCookie : change.versionCookie,
+    })
+  }
+
+  collisions := make(map[string]*SyncSlugCollision)
+  claim := func(slug string) *SyncSlugCollision {
+    if collisions[slug] == nil {
+      collisions[slug] = &SyncSlugCollision{ Slug: slug, ExternPaths: make([]string, 0), PubIDs: make([]string, 0) }
+    }
+    return collisions[slug]
+  }
+  for id, slug := range slugs {
+    if slug == `` {
+      continue
+    }
+    collision := claim(slug)
+    record := recordsByID[id]
+    if fromSource[id] && record.ExternPath != `` {
+      collision.ExternPaths = append(collision.ExternPaths, record.ExternPath)
+    } else {
+      collision.PubIDs = append(collision.PubIDs, record.PubID)
+    }
+  }
+  for externPath, slug := range createSlugs {
+    collision := claim(slug)
+    collision.ExternPaths = append(collision.ExternPaths, externPath)
+  }
+  for _, collision := range collisions {
+    if len(collision.ExternPaths) + len(collision.PubIDs) > 1 {
+      sort.Strings(collision.ExternPaths)
+      sort.Strings(collision.PubIDs)
+      plan.SlugCollisions = append(plan.SlugCollisions, collision)
+    }
+  }
+  sort.Slice(plan.SlugCollisions, func(i, j int) bool { return plan.SlugCollisions[i].Slug < plan.SlugCollisions[j].Slug })
+
+  return plan, nil
+}
@@ -0,0 +1,77 @@
+package content
+
+import (
+  "context"
+  "database/sql/driver"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "reflect"
+  "testing"
+
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+
+  model "github.com/Liquid-Labs/catalyst-content-model/go/resources/content"
+)
+
+func TestPlanContentSourceSlugCollisions(t *testing.T) {
+  root := t.TempDir()
+  previousRoot := LocalDirRoot
+  LocalDirRoot = root
+  defer func() { LocalDirRoot = previousRoot }()
+  if err := os.MkdirAll(filepath.Join(root, `site`, `docs`), 0755); err != nil {
+    t.Fatal(err)
+  }
+  for _, name := range []string{`about.md`, `news.md`, `guide.md`} {
+    if err := ioutil.WriteFile(filepath.Join(root, `site`, `docs`, name), []byte(`# ` + name), 0644); err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  const (
+    oldPubID   = `1b0c0b61-4d0e-4a3f-9bd1-6a6c7c2b1a01`
+    localPubID = `1b0c0b61-4d0e-4a3f-9bd1-6a6c7c2b1a02`
+    urlPubID   = `1b0c0b61-4d0e-4a3f-9bd1-6a6c7c2b1a03`
+  )
+  sourceRecord := []driver.Value{int64(1), oldPubID, `docs/old.md`, `v1`, `old`, int64(0)}
+  defer useFakeDB(t, map[string]fakeQueryHandler{
+    listContentSourceConfigQuery : func(args []driver.Value) ([]string, [][]driver.Value, error) {
+      return fakeColumns(2), nil, nil
+    },
+    listSyncedContentQuery : func(args []driver.Value) ([]string, [][]driver.Value, error) {
+      return fakeColumns(6), [][]driver.Value{sourceRecord}, nil
+    },
+    listNamespaceContentQuery : func(args []driver.Value) ([]string, [][]driver.Value, error) {
+      return fakeColumns(6), [][]driver.Value{
+        sourceRecord,
+        { int64(2), localPubID, nil, nil, `about`, int64(0) },
+        { int64(3), urlPubID, `https://example.com/news`, `etag`, `news`, int64(0) },
+      }, nil
+    },
+  })()
+
+  cs := &model.ContentSource{ SourceType: nulls.NewString(`LOCAL_DIR`), Name: nulls.NewString(`site`) }
+  cs.Id = nulls.NewInt64(1)
+  cs.Config = map[string]nulls.String{
+    `directory`   : nulls.NewString(filepath.Join(root, `site`)),
+    `contentPath` : nulls.NewString(`docs/`),
+  }
+  plan, restErr := PlanContentSource(cs, context.Background())
+  if restErr != nil {
+    t.Fatalf(`could not plan: %v (%v)`, restErr, restErr.Cause())
+  }
+
+  if len(plan.Create) != 3 || len(plan.Delete) != 1 || plan.Delete[0].ExternPath != `docs/old.md` {
+    t.Errorf(`planned %d creates and deletes %v`, len(plan.Create), plan.Delete)
+  }
+  expected := []*SyncSlugCollision{
+    { Slug: `about`, ExternPaths: []string{`docs/about.md`}, PubIDs: []string{localPubID} },
+    { Slug: `news`, ExternPaths: []string{`docs/news.md`}, PubIDs: []string{urlPubID} },
+  }
+  if !reflect.DeepEqual(plan.SlugCollisions, expected) {
+    for _, collision := range plan.SlugCollisions {
+      t.Logf(`collision: %+v`, collision)
+    }
+    t.Errorf(`unexpected slug collisions`)
+  }
+}
@@ -0,0 +1,177 @@
+package content
+
+import (
+  "context"
+  "database/sql"
+  "encoding/json"
+  "fmt"
+  "log"
+
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/Liquid-Labs/go-rest/rest"
+
+  model "github.com/Liquid-Labs/catalyst-content-model/go/resources/content"
+)
+
+// Sync run triggers.
+const (
+  SyncTriggerManual    = `MANUAL`
+  SyncTriggerScheduled = `SCHEDULED`
+  SyncTriggerWebhook   = `WEBHOOK`
+)
+
+// Sync run statuses. A 'PARTIAL' run completed, but failed to sync some items.
+const (
+  SyncStatusRunning   = `RUNNING`
+  SyncStatusSucceeded = `SUCCEEDED`
+  SyncStatusPartial   = `PARTIAL`
+  SyncStatusFailed    = `FAILED`
+)
+
+type syncContextKey int
+
+const syncTriggerKey syncContextKey = iota
+
+// WithSyncTrigger returns a context which records any sync runs under it as
+// started by 'trigger'. Sync runs default to SyncTriggerManual.
+func WithSyncTrigger(ctx context.Context, trigger string) context.Context {
+  return context.WithValue(ctx, syncTriggerKey, trigger)
+}
+
+func syncTrigger(ctx context.Context) string {
+  if trigger, ok := ctx.Value(syncTriggerKey).(string); ok {
+    return trigger
+  }
+  return SyncTriggerManual
+}
+
+// SyncRun records a single execution of a content source sync. Times are in
+// Unix seconds.
+type SyncRun struct {
+  ID         int64          `json:"id"`
+  Trigger    string         `json:"trigger"`
+  Status     string         `json:"status"`
+  Version    nulls.String   `json:"version"`
+  StartedAt  int64          `json:"startedAt"`
+  FinishedAt nulls.Int64    `json:"finishedAt"`
+  Created    int            `json:"created"`
+  Updated    int            `json:"updated"`
+  Deleted    int            `json:"deleted"`
+  Failed     int            `json:"failed"`
+  Failures   []*SyncFailure `json:"failures"`
+  Message    nulls.String   `json:"message"`
+}
+
+// recordSyncRun runs the sync, recording the run before and after. A failure
+// to record the run is logged, but does not prevent the sync.
+func recordSyncRun(cs *model.ContentSource, trigger string, ctx context.Context, syncFunc func(context.Context) (*SyncSummary, rest.RestError)) (*SyncSummary, rest.RestError) {
+  res, err := createSyncRunStmt.ExecContext(ctx, trigger, SyncStatusRunning, cs.PubId)
+  if err != nil {
+    log.Printf(`Could not record sync run for content source '%s': %v`, cs.Name.String, err)
+    return syncFunc(ctx)
+  }
+  // The insert selects the source; if it's gone, there is no run to finish.
+  if count, err := res.RowsAffected(); err != nil || count == 0 {
+    log.Printf(`Could not record sync run for content source '%s': source not found (%v)`, cs.Name.String, err)
+    return syncFunc(ctx)
+  }
+  runID, err := res.LastInsertId()
+  if err != nil {
+    log.Printf(`Could not record sync run for content source '%s': %v`, cs.Name.String, err)
+    return syncFunc(ctx)
+  }
+
+  summary, restErr := syncFunc(ctx)
+
+  status, version, message := SyncStatusSucceeded, nulls.NewNullString(), nulls.NewNullString()
+  failures := make([]*SyncFailure, 0)
+  var created, updated, deleted, failed int
+  if summary != nil {
+    if summary.Version != `` {
+      version = nulls.NewString(summary.Version)
+    }
+    created, updated, deleted, failed = summary.Created, summary.Updated, summary.Deleted, summary.Failed
+    failures = summary.Failures
+    if summary.Failed > 0 {
+      status = SyncStatusPartial
+    }
+  }
+  if restErr != nil {
+    status, message = SyncStatusFailed, nulls.NewString(restErr.Error())
+  }
+  failuresJSON, err := json.Marshal(failures)
+  if err != nil {
+    failuresJSON = []byte(`[]`)
+  }
+
+  // The run is recorded even if the sync was cancelled.
+  if _, err := finishSyncRunStmt.ExecContext(context.Background(), status, version,
+      created, updated, deleted, failed, string(failuresJSON), message, runID); err != nil {
+    log.Printf(`Could not record sync run outcome for content source '%s': %v`, cs.Name.String, err)
+  }
+
+  return summary, restErr
+}
+
+// FailInterruptedSyncRuns marks runs left 'RUNNING' by a prior process as
+// 'FAILED' and returns the number of runs marked. It must be called at
+// startup, before any syncs begin; a single process is assumed.
+func FailInterruptedSyncRuns(ctx context.Context) (int64, error) {
+  res, err := failInterruptedSyncRunsStmt.ExecContext(ctx, SyncStatusFailed, `Interrupted; the server stopped before the sync finished.`, SyncStatusRunning)
+  if err != nil {
+    return 0, err
+  }
+  return res.RowsAffected()
+}
+
+// lastSyncedVersion retrieves the source version synced by the most recent
+// finished sync run, provided it succeeded in full. Otherwise, including when
+// the source has never been synced, '' is returned.
+func lastSyncedVersion(cs *model.ContentSource, ctx context.Context) (string, error) {
+  var status string
+  var version nulls.String
+  err := getLastSyncRunStmt.QueryRowContext(ctx, cs.PubId, SyncStatusRunning).Scan(&status, &version)
+  if err == sql.ErrNoRows {
+    return ``, nil
+  } else if err != nil {
+    return ``, err
+  }
+  if status != SyncStatusSucceeded {
+    return ``, nil
+  }
+  return version.String, nil
+}
+
+// ListSyncRuns retrieves the most recent sync runs of the content source,
+// newest first. Attempting to list the runs of a non-existent content source
+// results in a rest.NotFoundError.
+func ListSyncRuns(pubID string, limit int, ctx context.Context) ([]*SyncRun, rest.RestError) {
+  if _, restErr := GetContentSource(pubID, ctx); restErr != nil {
+    return nil, restErr
+  }
+
+  rows, err := listSyncRunsStmt.QueryContext(ctx, pubID, limit)
+  if err != nil {
+    return nil, rest.ServerError(fmt.Sprintf(`Error retrieving sync runs for content source '%s'.`, pubID), err)
+  }
+  defer rows.Close()
+
+  runs := make([]*SyncRun, 0)
+  for rows.Next() {
+    var run SyncRun
+    var failures nulls.String
+    if err := rows.Scan(&run.ID, &run.Trigger, &run.Status, &run.Version, &run.StartedAt, &run.FinishedAt,
+        &run.Created, &run.Updated, &run.Deleted, &run.Failed, &failures, &run.Message); err != nil {
+      return nil, rest.ServerError(fmt.Sprintf(`Problem getting sync run data for content source '%s'.`, pubID), err)
+    }
+    run.Failures = make([]*SyncFailure, 0)
+    if !failures.IsEmpty() {
+      if err := json.Unmarshal([]byte(failures.String), &run.Failures); err != nil {
+        return nil, rest.ServerError(fmt.Sprintf(`Problem getting sync run data for content source '%s'.`, pubID), err)
+      }
+    }
+    runs = append(runs, &run)
+  }
+
+  return runs, nil
+}
@@ -0,0 +1,274 @@
+package content
+
+import (
+  "context"
+  "crypto/hmac"
+  "crypto/sha256"
+  "encoding/hex"
+  "encoding/xml"
+  "fmt"
+  "io"
+  "io/ioutil"
+  "net/http"
+  "net/url"
+  "regexp"
+  "sort"
+  "strings"
+  "time"
+
+  model "github.com/Liquid-Labs/catalyst-content-model/go/resources/content"
+)
+
+// s3SourceReader reads the objects under the content path (prefix) of an S3
+// bucket. The 'endpoint' configuration may be used to point at an
+// S3-compatible service, such as MinIO, in which case path-style addressing is
+// used. Requests are signed (AWS Signature Version 4) when an access key is
+// configured. Requests use sourceAPIClient, so the endpoint must resolve to a
+// public address, and responses are size limited.
+//
+// Buckets cannot be pinned, so object ETags are verified when reading and an
+// object changed after listing fails to sync until the next run.
+type s3SourceReader struct {
+  client          *http.Client
+  baseURL         *url.URL
+  region          string
+  accessKeyID     string
+  secretAccessKey string
+  contentPath     string
+  createdAt       time.Time
+  etags           map[string]string
+}
+
+// s3BucketPattern matches valid bucket names, which keeps the bucket from
+// altering the host or path of the requests.
+var s3BucketPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// s3RegionPattern matches region names, e.g. 'us-east-1', for the same reason.
+var s3RegionPattern = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+func newS3SourceReader(cs *model.ContentSource) (*s3SourceReader, error) {
+  bucket := cs.Config[`bucket`]
+  if bucket.IsEmpty() {
+    return nil, fmt.Errorf(`no 'bucket' configuration found`)
+  }
+  if !s3BucketPattern.MatchString(bucket.String) {
+    return nil, fmt.Errorf(`invalid bucket name '%s'`, bucket.String)
+  }
+  region := `us-east-1`
+  if !cs.Config[`region`].IsEmpty() {
+    region = cs.Config[`region`].String
+  }
+  if !s3RegionPattern.MatchString(region) {
+    return nil, fmt.Errorf(`invalid region '%s'`, region)
+  }
+
+  var baseURL *url.URL
+  var err error
+  if cs.Config[`endpoint`].IsEmpty() {
+    baseURL, err = url.Parse(`https://` + bucket.String + `.s3.` + region + `.amazonaws.com/`)
+  } else {
+    baseURL, err = url.Parse(strings.TrimSuffix(cs.Config[`endpoint`].String, `/`) + `/` + bucket.String + `/`)
+  }
+  if err != nil {
+    return nil, fmt.Errorf(`invalid S3 endpoint: %v`, err)
+  }
+  if _, err := checkSourceAPIURL(baseURL.String()); err != nil {
+    return nil, fmt.Errorf(`S3 endpoint not permitted: %v`, err)
+  }
+
+  return &s3SourceReader{
+    client          : sourceAPIClient,
+    baseURL         : baseURL,
+    region          : region,
+    accessKeyID     : cs.Config[`accessKeyID`].String,
+    secretAccessKey : cs.Config[`secretAccessKey`].String,
+    contentPath     : contentPathPrefix(cs.Config[`contentPath`].String),
+    createdAt       : time.Now(),
+    etags           : make(map[string]string),
+  }, nil
+}
+
+// Version reports the time the reader was created.
+func (r *s3SourceReader) Version() string {
+  return r.createdAt.UTC().Format(time.RFC3339)
+}
+
+type s3ListBucketResult struct {
+  IsTruncated           bool   `xml:"IsTruncated"`
+  NextContinuationToken string `xml:"NextContinuationToken"`
+  Contents              []struct {
+    Key  string `xml:"Key"`
+    ETag string `xml:"ETag"`
+  } `xml:"Contents"`
+}
+
+// ListItems uses the object ETags as the version cookies. Keys ending in '/'
+// are folder placeholders and are ignored.
+func (r *s3SourceReader) ListItems(ctx context.Context) (map[string]string, error) {
+  items := make(map[string]string)
+  query := url.Values{ `list-type`: {`2`}, `prefix`: {r.contentPath} }
+  for {
+    response, err := r.get(ctx, ``, query, nil)
+    if err != nil {
+      return nil, fmt.Errorf(`problem while listing bucket '%s': %v`, r.baseURL, err)
+    }
+    var result s3ListBucketResult
+    body, err := readLimited(response.Body, maxSourceListingSize)
+    response.Body.Close()
+    if err == nil {
+      err = xml.Unmarshal(body, &result)
+    }
+    if err != nil {
+      return nil, fmt.Errorf(`problem while listing bucket '%s': %v`, r.baseURL, err)
+    }
+
+    for _, object := range result.Contents {
+      if !strings.HasSuffix(object.Key, `/`) {
+        items[object.Key] = strings.Trim(object.ETag, `"`)
+      }
+    }
+
+    if !result.IsTruncated || result.NextContinuationToken == `` {
+      break
+    }
+    query.Set(`continuation-token`, result.NextContinuationToken)
+  }
+  r.etags = items
+
+  return items, nil
+}
+
+func (r *s3SourceReader) ReadItem(ctx context.Context, externPath string) ([]byte, error) {
+  header := make(http.Header)
+  if etag, ok := r.etags[externPath]; ok {
+    header.Set(`If-Match`, `"` + etag + `"`)
+  }
+  response, err := r.get(ctx, externPath, nil, header)
+  if err != nil {
+    return nil, fmt.Errorf(`problem while retrieving object '%s' from '%s': %v`, externPath, r.baseURL, err)
+  }
+  defer response.Body.Close()
+
+  body, err := readLimited(response.Body, maxSourceItemSize)
+  if err != nil {
+    return nil, fmt.Errorf(`problem while retrieving object '%s' from '%s': %v`, externPath, r.baseURL, err)
+  }
+  return body, nil
+}
+
+// get issues a (signed) GET for the key relative to the bucket. Non-200
+// responses result in an error.
+func (r *s3SourceReader) get(ctx context.Context, key string, query url.Values, header http.Header) (*http.Response, error) {
+  requestURL := *r.baseURL
+  requestURL.Path = r.baseURL.Path + key
+  requestURL.RawPath = r.baseURL.EscapedPath() + s3URIEncode(key, false)
+  requestURL.RawQuery = s3CanonicalQuery(query)
+
+  request, err := http.NewRequest(`GET`, requestURL.String(), nil)
+  if err != nil {
+    return nil, err
+  }
+  request = request.WithContext(ctx)
+  for name, values := range header {
+    request.Header[name] = values
+  }
+  if r.accessKeyID != `` {
+    signS3Request(request, r.accessKeyID, r.secretAccessKey, r.region, time.Now())
+  }
+
+  response, err := r.client.Do(request)
+  if err != nil {
+    return nil, err
+  }
+  if response.StatusCode != http.StatusOK {
+    defer response.Body.Close()
+    message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 512))
+    return nil, fmt.Errorf(`S3 responded '%s': %s`, response.Status, message)
+  }
+
+  return response, nil
+}
+
+const s3EmptyPayloadHash = `e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855`
+
+// signS3Request adds AWS Signature Version 4 authorization for a request
+// without a body. The host and all headers present on the request are signed.
+func signS3Request(request *http.Request, accessKeyID string, secretAccessKey string, region string, now time.Time) {
+  amzDate := now.UTC().Format(`20060102T150405Z`)
+  date := amzDate[:8]
+  request.Header.Set(`X-Amz-Date`, amzDate)
+  request.Header.Set(`X-Amz-Content-Sha256`, s3EmptyPayloadHash)
+
+  headers := map[string]string{ `host`: request.URL.Host }
+  for name, values := range request.Header {
+    headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, `,`))
+  }
+  names := make([]string, 0, len(headers))
+  for name := range headers {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  var canonicalHeaders strings.Builder
+  for _, name := range names {
+    canonicalHeaders.WriteString(name + `:` + headers[name] + "\n")
+  }
+  signedHeaders := strings.Join(names, `;`)
+
+  canonicalRequest := strings.Join([]string{
+    request.Method,
+    request.URL.EscapedPath(),
+    request.URL.RawQuery,
+    canonicalHeaders.String(),
+    signedHeaders,
+    s3EmptyPayloadHash,
+  }, "\n")
+  scope := date + `/` + region + `/s3/aws4_request`
+  canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+  stringToSign := `AWS4-HMAC-SHA256` + "\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+  key := []byte(`AWS4` + secretAccessKey)
+  for _, part := range []string{date, region, `s3`, `aws4_request`} {
+    key = s3HMAC(key, part)
+  }
+  signature := hex.EncodeToString(s3HMAC(key, stringToSign))
+
+  request.Header.Set(`Authorization`, `AWS4-HMAC-SHA256 Credential=` + accessKeyID + `/` + scope +
+    `, SignedHeaders=` + signedHeaders + `, Signature=` + signature)
+}
+
+func s3HMAC(key []byte, data string) []byte {
+  mac := hmac.New(sha256.New, key)
+  mac.Write([]byte(data))
+  return mac.Sum(nil)
+}
+
+// s3CanonicalQuery encodes the query sorted by key, as required for signing.
+func s3CanonicalQuery(query url.Values) string {
+  keys := make([]string, 0, len(query))
+  for key := range query {
+    keys = append(keys, key)
+  }
+  sort.Strings(keys)
+  pairs := make([]string, 0, len(keys))
+  for _, key := range keys {
+    for _, value := range query[key] {
+      pairs = append(pairs, s3URIEncode(key, true) + `=` + s3URIEncode(value, true))
+    }
+  }
+  return strings.Join(pairs, `&`)
+}
+
+// s3URIEncode percent-encodes all but the unreserved characters and, unless
+// 'encodeSlash', '/'.
+func s3URIEncode(value string, encodeSlash bool) string {
+  var encoded strings.Builder
+  for _, b := range []byte(value) {
+    if ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z') || ('0' <= b && b <= '9') ||
+        b == '-' || b == '_' || b == '.' || b == '~' || (b == '/' && !encodeSlash) {
+      encoded.WriteByte(b)
+    } else {
+      fmt.Fprintf(&encoded, `%%%02X`, b)
+    }
+  }
+  return encoded.String()
+}
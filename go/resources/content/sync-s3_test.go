@@ -0,0 +1,28 @@
+package content
+
+import (
+  "testing"
+
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+
+  model "github.com/Liquid-Labs/catalyst-content-model/go/resources/content"
+)
+
+func TestS3SourceReaderRefusesBucketAndRegion(t *testing.T) {
+  for _, config := range []map[string]string{
+    { `bucket`: `evil.com/x` },
+    { `bucket`: `Site` },
+    { `bucket`: `site`, `region`: `us-east-1.evil.com/` },
+    { `bucket`: `site`, `region`: `evil.com#` },
+    { `bucket`: `site`, `region`: `US-EAST-1` },
+  } {
+    cs := &model.ContentSource{ SourceType: nulls.NewString(`S3`), Name: nulls.NewString(`site`) }
+    cs.Config = make(map[string]nulls.String)
+    for key, value := range config {
+      cs.Config[key] = nulls.NewString(value)
+    }
+    if _, err := newS3SourceReader(cs); err == nil {
+      t.Errorf(`expected %v to be refused`, config)
+    }
+  }
+}
@@ -0,0 +1,165 @@
+package content
+
+import (
+  "context"
+  "log"
+  "math/rand"
+  "sync"
+  "time"
+
+  "github.com/Liquid-Labs/go-rest/rest"
+
+  model "github.com/Liquid-Labs/catalyst-content-model/go/resources/content"
+)
+
+// urlSyncKey identifies the URL-sourced content sweep among the scheduled
+// syncs. Namespace names are lower case, so it cannot collide with a source.
+const urlSyncKey = `URL`
+
+// SyncScheduler periodically syncs each content source and the URL-sourced
+// content. Each sync is delayed by a random amount up to the jitter so that
+// sources are not all hit at once. A sync still running from a prior round is
+// skipped. Outcomes are logged; content source syncs are also recorded as
+// sync runs (see ListSyncRuns).
+type SyncScheduler struct {
+  interval time.Duration
+  jitter   time.Duration
+  random   *rand.Rand
+  ctx      context.Context
+  cancel   context.CancelFunc
+  mutex    sync.Mutex
+  running  map[string]bool
+}
+
+func NewSyncScheduler(interval time.Duration, jitter time.Duration) *SyncScheduler {
+  ctx, cancel := context.WithCancel(context.Background())
+  return &SyncScheduler{
+    interval : interval,
+    jitter   : jitter,
+    random   : rand.New(rand.NewSource(time.Now().UnixNano())),
+    ctx      : ctx,
+    cancel   : cancel,
+    running  : make(map[string]bool),
+  }
+}
+
+// Start begins scheduling in the background. The first round starts
+// immediately.
+func (s *SyncScheduler) Start() {
+  go func() {
+    ticker := time.NewTicker(s.interval)
+    defer ticker.Stop()
+    for {
+      s.scheduleRound()
+      select {
+      case <-s.ctx.Done():
+        return
+      case <-ticker.C:
+      }
+    }
+  }()
+}
+
+// Stop ends scheduling and cancels any syncs in progress.
+func (s *SyncScheduler) Stop() {
+  s.cancel()
+}
+
+func (s *SyncScheduler) scheduleRound() {
+  sources, restErr := ListContentSources(s.ctx)
+  if restErr != nil {
+    log.Printf(`Scheduled sync could not list content sources: %v`, restErr)
+    sources = make([]*model.ContentSource, 0)
+  }
+
+  for _, cs := range sources {
+    cs := cs
+    s.launch(cs.Name.String, func(ctx context.Context) (*SyncSummary, rest.RestError) {
+      return SyncContentSource(cs, WithSyncTrigger(ctx, SyncTriggerScheduled))
+    })
+  }
+  s.launch(urlSyncKey, syncURLContent)
+}
+
+// launch runs the sync after a random delay unless the source is already
+// running.
+func (s *SyncScheduler) launch(source string, syncFunc func(context.Context) (*SyncSummary, rest.RestError)) {
+  s.mutex.Lock()
+  if s.running[source] {
+    s.mutex.Unlock()
+    log.Printf(`Scheduled sync of '%s' skipped; prior sync still running.`, source)
+    return
+  }
+  s.running[source] = true
+  s.mutex.Unlock()
+
+  var delay time.Duration
+  if s.jitter > 0 {
+    delay = time.Duration(s.random.Int63n(int64(s.jitter)))
+  }
+
+  go func() {
+    defer func() {
+      s.mutex.Lock()
+      delete(s.running, source)
+      s.mutex.Unlock()
+    }()
+
+    select {
+    case <-s.ctx.Done():
+      return
+    case <-time.After(delay):
+    }
+
+    summary, restErr := syncFunc(s.ctx)
+    if restErr != nil {
+      log.Printf(`Scheduled sync of '%s' failed: %v`, source, restErr)
+    } else if summary.Failed > 0 {
+      log.Printf(`Scheduled sync of '%s' completed with %d failures.`, source, summary.Failed)
+    }
+  }()
+}
+
+// syncURLContent syncs each URL-sourced text item. Item failures are recorded
+// in the summary.
+func syncURLContent(ctx context.Context) (*SyncSummary, rest.RestError) {
+  rows, err := listURLContentStmt.QueryContext(ctx)
+  if err != nil {
+    return nil, rest.ServerError(`Problem while gathering URL content.`, err)
+  }
+  pubIDs := make([]string, 0)
+  for rows.Next() {
+    var pubID string
+    if err := rows.Scan(&pubID); err != nil {
+      rows.Close()
+      return nil, rest.ServerError(`Problem while gathering URL content.`, err)
+    }
+    pubIDs = append(pubIDs, pubID)
+  }
+  rows.Close()
+  if err := rows.Err(); err != nil {
+    return nil, rest.ServerError(`Problem while gathering URL content.`, err)
+  }
+
+  summary := &SyncSummary{ Source: urlSyncKey, Failures: make([]*SyncFailure, 0) }
+  for _, pubID := range pubIDs {
+    if ctx.Err() != nil {
+      return summary, rest.ServerError(`URL content sync interrupted.`, ctx.Err())
+    }
+    c, restErr := GetContentTypeText(pubID, ctx)
+    if restErr != nil {
+      summary.addFailure(pubID, restErr)
+      continue
+    }
+    newC, restErr := SyncContentTypeText(c, ctx)
+    if restErr != nil {
+      summary.addFailure(c.ExternPath.String, restErr)
+    } else if newC != c {
+      // An unmodified resource leaves the item as is.
+      summary.Updated += 1
+    }
+  }
+
+  return summary, nil
+}
+
@@ -0,0 +1,431 @@
+package content
+
+import (
+  "context"
+  "database/sql"
+  "errors"
+  "fmt"
+  "path"
+  "regexp"
+  "sort"
+  "strings"
+  "unicode"
+
+  "github.com/Liquid-Labs/go-api/sqldb"
+  "github.com/Liquid-Labs/go-nullable-mysql/nulls"
+  "github.com/Liquid-Labs/go-rest/rest"
+
+  model "github.com/Liquid-Labs/catalyst-content-model/go/resources/content"
+)
+
+// contentSourceReader provides a consistent view of a content source for a
+// single sync run. Implementations pin the source to a single version (e.g., a
+// commit) when created so that changes made while the sync is running do not
+// produce an inconsistent namespace.
+type contentSourceReader interface {
+  // Version identifies the pinned version of the source.
+  Version() string
+  // ListItems maps the extern path of each syncable item to its version
+  // cookie. The cookie must change whenever the item content changes.
+  ListItems(ctx context.Context) (map[string]string, error)
+  // ReadItem retrieves the content of the item at the pinned version.
+  ReadItem(ctx context.Context, externPath string) ([]byte, error)
+}
+
+// syncedContent is the sync-relevant state of an existing content record.
+type syncedContent struct {
+  ID            int64
+  PubID         string
+  ExternPath    string
+  VersionCookie string
+  Slug          string
+  Deleted       bool
+}
+
+// listSyncedContent retrieves the records in the namespace synced from the
+// source type. Local and URL-sourced content are not included.
+func listSyncedContent(namespace string, sourceType string, ctx context.Context) ([]*syncedContent, error) {
+  return listSyncedContentHelper(listSyncedContentStmt, ctx, namespace, sourceType)
+}
+
+// listNamespaceContent retrieves the live content in the namespace, from any
+// source.
+func listNamespaceContent(namespace string, ctx context.Context) ([]*syncedContent, error) {
+  return listSyncedContentHelper(listNamespaceContentStmt, ctx, namespace)
+}
+
+func listSyncedContentHelper(stmt *sql.Stmt, ctx context.Context, args ...interface{}) ([]*syncedContent, error) {
+  rows, err := stmt.QueryContext(ctx, args...)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  records := make([]*syncedContent, 0)
+  for rows.Next() {
+    var record syncedContent
+    var externPath, versionCookie, slug nulls.String
+    if err := rows.Scan(&record.ID, &record.PubID, &externPath, &versionCookie, &slug, &record.Deleted); err != nil {
+      return nil, err
+    }
+    record.ExternPath, record.VersionCookie, record.Slug = externPath.String, versionCookie.String, slug.String
+    records = append(records, &record)
+  }
+
+  return records, rows.Err()
+}
+
+// syncChange is a single change needed to bring a namespace in line with the
+// source. The record is nil for items to be created.
+type syncChange struct {
+  record        *syncedContent
+  externPath    string
+  versionCookie string
+}
+
+// diffContentSource determines the changes needed to bring the namespace in
+// line with the source: items new to the source are created, items whose
+// version cookie has changed are updated, and records whose item has
+// disappeared from the source are (soft) deleted. Deleted content is left in
+// the trash, whether or not the item remains in the source; once restored, it
+// is updated as usual. Records without an extern path are local content and
+// are not considered. Changes are ordered by extern path.
+func diffContentSource(items map[string]string, records []*syncedContent) (creates []*syncChange, updates []*syncChange, deletes []*syncChange) {
+  known := make(map[string]bool)
+  for _, record := range records {
+    if record.ExternPath == `` {
+      continue
+    }
+    known[record.ExternPath] = true
+    versionCookie, exists := items[record.ExternPath]
+    if !exists {
+      if record.Deleted {
+        continue // already in the trash
+      }
+      deletes = append(deletes, &syncChange{ record: record, externPath: record.ExternPath })
+    } else if !record.Deleted && versionCookie != record.VersionCookie {
+      updates = append(updates, &syncChange{ record: record, externPath: record.ExternPath, versionCookie: versionCookie })
+    }
+  }
+  for externPath, versionCookie := range items {
+    if !known[externPath] {
+      creates = append(creates, &syncChange{ externPath: externPath, versionCookie: versionCookie })
+    }
+  }
+
+  for _, changes := range [][]*syncChange{creates, updates, deletes} {
+    sort.Slice(changes, func(i, j int) bool { return changes[i].externPath < changes[j].externPath })
+  }
+  return creates, updates, deletes
+}
+
+// reconcileContentSource applies the changes determined by diffContentSource.
+// Each item is processed in its own transaction; item failures are recorded in
+// the summary rather than aborting the run.
+func reconcileContentSource(cs *model.ContentSource, reader contentSourceReader, summary *SyncSummary, ctx context.Context) rest.RestError {
+  ctx = WithRevisionSource(ctx, RevisionSourceSync)
+  summary.Version = reader.Version()
+
+  items, err := reader.ListItems(ctx)
+  if err != nil {
+    return rest.ServerError(fmt.Sprintf(`Problem listing items for content source '%s'.`, cs.Name.String), err)
+  }
+
+  records, err := listSyncedContent(cs.Name.String, cs.SourceType.String, ctx)
+  if err != nil {
+    return rest.ServerError(`Problem while gathering current records.`, err)
+  }
+
+  creates, updates, deletes := diffContentSource(items, records)
+  for _, change := range deletes {
+    if restErr := deleteSyncedContent(change.record, ctx); restErr != nil {
+      summary.addFailure(change.externPath, restErr)
+    } else {
+      summary.Deleted += 1
+    }
+  }
+  for _, change := range updates {
+    if restErr := refreshSyncedContent(change.record, change.versionCookie, reader, ctx); restErr != nil {
+      summary.addFailure(change.externPath, restErr)
+    } else {
+      summary.Updated += 1
+    }
+  }
+  for _, change := range creates {
+    if restErr := createSyncedContent(cs, change.externPath, change.versionCookie, reader, ctx); restErr != nil {
+      summary.addFailure(change.externPath, restErr)
+    } else {
+      summary.Created += 1
+    }
+  }
+
+  return nil
+}
+
+// itemVersionReader is a contentSourceReader able to retrieve the version of a
+// single item, supporting incremental reconciliation.
+type itemVersionReader interface {
+  contentSourceReader
+  // ItemVersion retrieves the version cookie of the item at the pinned version,
+  // or errItemNotFound if the item does not exist.
+  ItemVersion(ctx context.Context, externPath string) (string, error)
+}
+
+var errItemNotFound = errors.New(`item not found`)
+
+// reconcileContentSourceItems reconciles only the given items, which may have
+// been added, modified, or removed, with the same semantics as
+// reconcileContentSource.
+func reconcileContentSourceItems(cs *model.ContentSource, reader itemVersionReader, externPaths []string, summary *SyncSummary, ctx context.Context) rest.RestError {
+  ctx = WithRevisionSource(ctx, RevisionSourceSync)
+  summary.Version = reader.Version()
+
+  records, err := listSyncedContent(cs.Name.String, cs.SourceType.String, ctx)
+  if err != nil {
+    return rest.ServerError(`Problem while gathering current records.`, err)
+  }
+  recordsByPath := make(map[string]*syncedContent)
+  for _, record := range records {
+    recordsByPath[record.ExternPath] = record
+  }
+
+  for _, externPath := range externPaths {
+    record, known := recordsByPath[externPath]
+    versionCookie, err := reader.ItemVersion(ctx, externPath)
+    if err == errItemNotFound {
+      if !known || record.Deleted {
+        continue
+      }
+      if restErr := deleteSyncedContent(record, ctx); restErr != nil {
+        summary.addFailure(externPath, restErr)
+      } else {
+        summary.Deleted += 1
+      }
+    } else if err != nil {
+      summary.addFailure(externPath, err)
+    } else if !known {
+      if restErr := createSyncedContent(cs, externPath, versionCookie, reader, ctx); restErr != nil {
+        summary.addFailure(externPath, restErr)
+      } else {
+        summary.Created += 1
+      }
+    } else if !record.Deleted && versionCookie != record.VersionCookie {
+      if restErr := refreshSyncedContent(record, versionCookie, reader, ctx); restErr != nil {
+        summary.addFailure(externPath, restErr)
+      } else {
+        summary.Updated += 1
+      }
+    }
+  }
+
+  return nil
+}
+
+// deleteSyncedContent soft deletes content whose item has been removed from
+// the source, leaving it in the trash to be restored or purged by an
+// administrator. See DeleteContent and PurgeContent.
+func deleteSyncedContent(record *syncedContent, ctx context.Context) rest.RestError {
+  return execTombstoneUpdate(contentSoftDeleteStmt, `delete`, record.PubID, ctx)
+}
+
+func refreshSyncedContent(record *syncedContent, versionCookie string, reader contentSourceReader, ctx context.Context) rest.RestError {
+  c, restErr := readSyncedUpdate(record, versionCookie, reader, ctx)
+  if restErr != nil {
+    return restErr
+  }
+
+  _, restErr = UpdateSyncedContentTypeText(c, ctx)
+  return restErr
+}
+
+// readSyncedUpdate builds the update for the record from the item. Only the
+// text, version cookie, and any front matter fields are set.
+func readSyncedUpdate(record *syncedContent, versionCookie string, reader contentSourceReader, ctx context.Context) (*model.ContentTypeText, rest.RestError) {
+  body, err := reader.ReadItem(ctx, record.ExternPath)
+  if err != nil {
+    return nil, rest.ServerError(`Could not retrieve item.`, err)
+  }
+
+  c := &model.ContentTypeText{}
+  c.PubId = nulls.NewString(record.PubID)
+  c.VersionCookie = nulls.NewString(versionCookie)
+  if err := applyFrontMatter(c, formatFromPath(record.ExternPath), body); err != nil {
+    return nil, rest.UnprocessableEntityError(`Could not parse item.`, err)
+  }
+
+  return c, nil
+}
+
+func createSyncedContent(cs *model.ContentSource, externPath string, versionCookie string, reader contentSourceReader, ctx context.Context) rest.RestError {
+  c, restErr := readSyncedContent(cs, externPath, versionCookie, reader, ctx)
+  if restErr != nil {
+    return restErr
+  }
+
+  txn, err := sqldb.DB.Begin()
+  if err != nil {
+    return rest.ServerError(`Could not create content record. (txn error)`, err)
+  }
+  if _, restErr := createContentTypeTextInTxn(c, ctx, txn); restErr != nil {
+    return restErr // already rolled back
+  }
+  if err := txn.Commit(); err != nil {
+    return rest.ServerError(`Could not create content record. (commit error)`, err)
+  }
+  return nil
+}
+
+// readSyncedContent builds new content from the item, with defaults derived
+// from the extern path overridden by any front matter.
+func readSyncedContent(cs *model.ContentSource, externPath string, versionCookie string, reader contentSourceReader, ctx context.Context) (*model.ContentTypeText, rest.RestError) {
+  body, err := reader.ReadItem(ctx, externPath)
+  if err != nil {
+    return nil, rest.ServerError(`Could not retrieve item.`, err)
+  }
+
+  c := &model.ContentTypeText{}
+  c.Namespace = cs.Name
+  c.SourceType = cs.SourceType
+  c.Type = nulls.NewString(`TEXT`)
+  c.ExternPath = nulls.NewString(externPath)
+  c.VersionCookie = nulls.NewString(versionCookie)
+  c.Slug = nulls.NewString(slugFromPath(externPath, contentPathPrefix(cs.Config[`contentPath`].String)))
+  c.Title = nulls.NewString(titleFromPath(externPath))
+  c.Format = nulls.NewString(formatFromPath(externPath))
+  if err := applyFrontMatter(c, c.Format.String, body); err != nil {
+    return nil, rest.UnprocessableEntityError(`Could not parse item.`, err)
+  }
+
+  return c, nil
+}
+
+// UpdateSyncedContentTypeText updates the text and version cookie of synced
+// content. The title, summary, slug, format, and contributors are updated only
+// when set (e.g., from front matter); otherwise, the locally managed values are
+// left untouched.
+func UpdateSyncedContentTypeText(c *model.ContentTypeText, ctx context.Context) (*model.ContentTypeText, rest.RestError) {
+  txn, err := sqldb.DB.Begin()
+  if err != nil {
+    return nil, rest.ServerError("Could not update content record. (txn error)", err)
+  }
+
+  if _, err := txn.Stmt(updateSyncedTextStmt).ExecContext(ctx, c.Text, c.VersionCookie, c.PubId); err != nil {
+    defer txn.Rollback()
+    return nil, rest.ServerError("Could not update content record.", err)
+  }
+  newContent, restErr := GetContentTypeTextInTxn(c.PubId.String, ctx, txn)
+  if restErr != nil {
+    defer txn.Rollback()
+    return nil, restErr
+  }
+  if c.Title.IsValid() || c.Summary.IsValid() || c.Slug.IsValid() || c.Format.IsValid() || c.Contributors != nil {
+    if newContent, restErr = updateSyncedMetadataInTxn(c, newContent, ctx, txn); restErr != nil {
+      return nil, restErr // already rolled back
+    }
+  }
+  if restErr := recordContentRevisionInTxn(newContent, ctx, txn); restErr != nil {
+    return nil, restErr // already rolled back
+  }
+  if err := txn.Commit(); err != nil {
+    return nil, rest.ServerError("Could not update content record. (commit error)", err)
+  }
+
+  return newContent, nil
+}
+
+// updateSyncedMetadataInTxn overlays the set metadata fields onto the current
+// content.
+func updateSyncedMetadataInTxn(c *model.ContentTypeText, current *model.ContentTypeText, ctx context.Context, txn *sql.Tx) (*model.ContentTypeText, rest.RestError) {
+  title, summary, slug, format := current.Title, current.Summary, current.Slug, current.Format
+  if c.Title.IsValid() {
+    title = c.Title
+  }
+  if c.Summary.IsValid() {
+    summary = c.Summary
+  }
+  if c.Slug.IsValid() {
+    slug = c.Slug
+  }
+  if c.Format.IsValid() {
+    format = c.Format
+  }
+  if _, err := txn.Stmt(updateContentTypeTextSansTextStmt).ExecContext(ctx, title, summary, current.ExternPath, slug, format, c.PubId); err != nil {
+    defer txn.Rollback()
+    return nil, rest.ServerError("Could not update content record.", err)
+  }
+
+  if c.Contributors != nil {
+    var id int64
+    if err := txn.Stmt(getContentIDByPubIDStmt).QueryRowContext(ctx, c.PubId).Scan(&id); err != nil {
+      defer txn.Rollback()
+      return nil, rest.ServerError("Could not update content contributors.", err)
+    }
+    if _, err := txn.Stmt(contentPurgeContributorsStmt).ExecContext(ctx, id); err != nil {
+      defer txn.Rollback()
+      return nil, rest.ServerError("Could not update content contributors.", err)
+    }
+    contribInsStmt := txn.Stmt(contributorInsertWithContentIDStmt)
+    for _, contrib := range c.Contributors {
+      if _, err := contribInsStmt.ExecContext(ctx, id, contrib.Role, contrib.SummaryCreditOrder, contrib.PubId); err != nil {
+        defer txn.Rollback()
+        return nil, rest.UnprocessableEntityError("Error updating contributors. Possible bad data.", err)
+      }
+    }
+  }
+
+  newContent, restErr := GetContentTypeTextInTxn(c.PubId.String, ctx, txn)
+  if restErr != nil {
+    defer txn.Rollback()
+    return nil, restErr
+  }
+  return newContent, nil
+}
+
+// contentPathPrefix normalizes a configured content path to a directory
+// prefix, so that 'docs' matches 'docs/intro.md' but not 'docs-old/intro.md'.
+// An empty content path matches every path.
+func contentPathPrefix(contentPath string) string {
+  contentPath = strings.Trim(contentPath, `/`)
+  if contentPath == `` {
+    return ``
+  }
+  return contentPath + `/`
+}
+
+var slugInvalidRe *regexp.Regexp = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// slugFromPath derives a slug from the extern path relative to the content
+// path, sans extension; e.g., 'docs/Getting Started/intro.md' with content
+// path 'docs/' yields 'getting-started-intro'.
+func slugFromPath(externPath string, contentPath string) string {
+  slug := strings.TrimPrefix(externPath, contentPath)
+  slug = strings.TrimSuffix(slug, path.Ext(slug))
+  slug = slugInvalidRe.ReplaceAllString(strings.ToLower(slug), `-`)
+  return strings.Trim(slug, `-`)
+}
+
+// titleFromPath derives a default title from the file name; e.g.,
+// 'docs/getting-started.md' yields 'Getting Started'.
+func titleFromPath(externPath string) string {
+  name := path.Base(externPath)
+  name = strings.TrimSuffix(name, path.Ext(name))
+  words := strings.FieldsFunc(name, func(r rune) bool { return r == '-' || r == '_' || r == ' ' })
+  for i, word := range words {
+    runes := []rune(word)
+    runes[0] = unicode.ToUpper(runes[0])
+    words[i] = string(runes)
+  }
+  return strings.Join(words, ` `)
+}
+
+// formatFromPath determines the content format from the file extension.
+func formatFromPath(externPath string) string {
+  switch strings.ToLower(path.Ext(externPath)) {
+  case `.md`, `.markdown`:
+    return `MARKDOWN`
+  case `.html`, `.htm`:
+    return `HTML`
+  default:
+    return `TEXT`
+  }
+}
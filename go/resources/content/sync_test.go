@@ -0,0 +1,28 @@
+package content
+
+import (
+  "testing"
+)
+
+func TestContentPathPrefix(t *testing.T) {
+  for _, tc := range []struct {
+    contentPath string
+    expected    string
+  }{
+    { ``, `` },
+    { `/`, `` },
+    { `docs`, `docs/` },
+    { `docs/`, `docs/` },
+    { `/docs/guides`, `docs/guides/` },
+  } {
+    if prefix := contentPathPrefix(tc.contentPath); prefix != tc.expected {
+      t.Errorf(`content path '%s' yielded '%s'; expected '%s'`, tc.contentPath, prefix, tc.expected)
+    }
+  }
+}
+
+func TestSlugFromPathWithoutTrailingSlash(t *testing.T) {
+  if slug := slugFromPath(`docs/Getting Started/intro.md`, contentPathPrefix(`docs`)); slug != `getting-started-intro` {
+    t.Errorf(`slug is '%s'`, slug)
+  }
+}
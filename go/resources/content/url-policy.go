@@ -0,0 +1,196 @@
+package content
+
+import (
+  "context"
+  "fmt"
+  "net"
+  neturl "net/url"
+  "strings"
+
+  "github.com/Liquid-Labs/go-rest/rest"
+)
+
+// AllowPrivateURLs permits URL content to resolve to private, loopback,
+// link-local, and other non-public addresses. It should only be set for
+// development and testing.
+var AllowPrivateURLs = false
+
+// allowedURLSchemes are the schemes URL content may use.
+var allowedURLSchemes = map[string]bool{ `http`: true, `https`: true }
+
+// blockedNetworks are the non-public address ranges URL content may not
+// resolve to unless AllowPrivateURLs is set.
+var blockedNetworks = mustParseCIDRs(
+  `0.0.0.0/8`,       // 'this' network
+  `10.0.0.0/8`,      // private
+  `100.64.0.0/10`,   // carrier-grade NAT
+  `127.0.0.0/8`,     // loopback
+  `169.254.0.0/16`,  // link-local, including cloud metadata services
+  `172.16.0.0/12`,   // private
+  `192.0.0.0/24`,    // IETF protocol assignments
+  `192.168.0.0/16`,  // private
+  `198.18.0.0/15`,   // benchmarking
+  `224.0.0.0/4`,     // multicast
+  `240.0.0.0/4`,     // reserved, including broadcast
+  `::/128`,          // unspecified
+  `::1/128`,         // loopback
+  `::/96`,           // IPv4-compatible (deprecated)
+  `2001::/32`,       // Teredo tunneling
+  `64:ff9b:1::/48`,  // local-use NAT64
+  `fc00::/7`,        // unique local
+  `fe80::/10`,       // link-local
+  `ff00::/8`,        // multicast
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+  networks := make([]*net.IPNet, len(cidrs))
+  for i, cidr := range cidrs {
+    _, network, err := net.ParseCIDR(cidr)
+    if err != nil {
+      panic(err)
+    }
+    networks[i] = network
+  }
+  return networks
+}
+
+// urlPolicy restricts the URLs content may be retrieved from. Hosts matching
+// the deny list are always refused. When the allow list is not empty, only
+// matching hosts are permitted.
+type urlPolicy struct {
+  allowHosts []string
+  denyHosts  []string
+}
+
+// namespaceURLPolicy retrieves the URL policy of the namespace. Content
+// without a namespace is subject only to the scheme and address checks.
+func namespaceURLPolicy(namespace string, ctx context.Context) (*urlPolicy, rest.RestError) {
+  if namespace == `` {
+    return &urlPolicy{}, nil
+  }
+  ns, restErr := GetNamespace(namespace, ctx)
+  if restErr != nil {
+    return nil, restErr
+  }
+  return &urlPolicy{ allowHosts: ns.URLAllowHosts, denyHosts: ns.URLDenyHosts }, nil
+}
+
+// checkURL verifies the scheme and host of the URL. Addresses are checked
+// separately, as they must be verified at connection time.
+func (p *urlPolicy) checkURL(url *neturl.URL) error {
+  if !allowedURLSchemes[strings.ToLower(url.Scheme)] {
+    return fmt.Errorf(`scheme '%s' is not allowed`, url.Scheme)
+  }
+  host := strings.TrimSuffix(strings.ToLower(url.Hostname()), `.`)
+  if host == `` {
+    return fmt.Errorf(`URL has no host`)
+  }
+  if url.User != nil {
+    return fmt.Errorf(`URL may not include user information`)
+  }
+  for _, pattern := range p.denyHosts {
+    if hostMatches(pattern, host) {
+      return fmt.Errorf(`host '%s' is denied`, host)
+    }
+  }
+  if len(p.allowHosts) == 0 {
+    return nil
+  }
+  for _, pattern := range p.allowHosts {
+    if hostMatches(pattern, host) {
+      return nil
+    }
+  }
+  return fmt.Errorf(`host '%s' is not allowed`, host)
+}
+
+// hostMatches matches the host against a pattern; a '*.' prefix matches any
+// subdomain, but not the domain itself.
+func hostMatches(pattern string, host string) bool {
+  if strings.HasPrefix(pattern, `*.`) {
+    return strings.HasSuffix(host, pattern[1:])
+  }
+  return host == pattern
+}
+
+// Translation prefixes which embed an IPv4 address in an IPv6 address.
+var (
+  nat64Network     = mustParseCIDRs(`64:ff9b::/96`)[0] // IPv4 in the last 4 bytes
+  sixToFourNetwork = mustParseCIDRs(`2002::/16`)[0]    // IPv4 in bytes 2 to 5
+)
+
+// checkIP refuses non-public addresses unless AllowPrivateURLs is set.
+// IPv4-mapped, NAT64, and 6to4 addresses are checked as the embedded IPv4
+// address.
+func checkIP(ip net.IP) error {
+  if AllowPrivateURLs {
+    return nil
+  }
+  checked := ip
+  if ip4 := ip.To4(); ip4 != nil {
+    checked = ip4
+  } else if ip16 := ip.To16(); ip16 != nil && nat64Network.Contains(ip16) {
+    checked = net.IPv4(ip16[12], ip16[13], ip16[14], ip16[15]).To4()
+  } else if ip16 != nil && sixToFourNetwork.Contains(ip16) {
+    checked = net.IPv4(ip16[2], ip16[3], ip16[4], ip16[5]).To4()
+  }
+  for _, network := range blockedNetworks {
+    if network.Contains(checked) {
+      return fmt.Errorf(`address '%s' is not publicly routable`, ip)
+    }
+  }
+  return nil
+}
+
+// checkResolved resolves the host and verifies each address.
+func checkResolved(ctx context.Context, host string) error {
+  addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+  if err != nil {
+    return fmt.Errorf(`could not resolve host '%s': %v`, host, err)
+  }
+  for _, addr := range addrs {
+    if err := checkIP(addr.IP); err != nil {
+      return fmt.Errorf(`host '%s' resolves to a blocked address: %v`, host, err)
+    }
+  }
+  return nil
+}
+
+// ValidateContentURL verifies the URL may be used as the extern path of URL
+// content in the namespace. The host is resolved so that obviously internal
+// URLs are refused up front; the addresses are checked again whenever the
+// content is fetched, since DNS may change.
+func ValidateContentURL(namespace string, url string, ctx context.Context) rest.RestError {
+  parsed, err := neturl.Parse(url)
+  if err != nil {
+    return rest.BadRequestError(fmt.Sprintf(`Invalid URL '%s'.`, url), err)
+  }
+  policy, restErr := namespaceURLPolicy(namespace, ctx)
+  if restErr != nil {
+    return restErr
+  }
+  if err := policy.checkURL(parsed); err != nil {
+    return rest.BadRequestError(fmt.Sprintf(`URL '%s' is not permitted: %v.`, url, err), err)
+  }
+  if err := checkResolved(ctx, parsed.Hostname()); err != nil {
+    return rest.BadRequestError(fmt.Sprintf(`URL '%s' is not permitted: %v.`, url, err), err)
+  }
+  return nil
+}
+
+type urlPolicyContextKey int
+
+const urlPolicyKey urlPolicyContextKey = iota
+
+// withURLPolicy returns a context under which the URLFetcher applies the
+// policy to redirects.
+func withURLPolicy(ctx context.Context, policy *urlPolicy) context.Context {
+  return context.WithValue(ctx, urlPolicyKey, policy)
+}
+
+func contextURLPolicy(ctx context.Context) *urlPolicy {
+  if policy, ok := ctx.Value(urlPolicyKey).(*urlPolicy); ok {
+    return policy
+  }
+  return &urlPolicy{}
+}
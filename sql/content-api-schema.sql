@@ -0,0 +1,116 @@
+-- Tables owned by the content API. The core content tables ('content_summary',
+-- 'content_type_text', 'namespace', etc.) are defined by
+-- catalyst-content-model.
+
+-- Associates content with arbitrary entities (projects, users, organizations,
+-- etc.) so the content can be listed in the context of that entity.
+CREATE TABLE content_contexts (
+  content INT(10) UNSIGNED NOT NULL,
+  context INT(10) UNSIGNED NOT NULL,
+  context_type VARCHAR(64) NOT NULL,
+  CONSTRAINT content_contexts_key PRIMARY KEY ( context, content ),
+  INDEX content_contexts_content_idx ( content ),
+  CONSTRAINT content_contexts_content_refs_content FOREIGN KEY ( content ) REFERENCES content_summary ( id ) ON DELETE CASCADE,
+  CONSTRAINT content_contexts_context_refs_entities FOREIGN KEY ( context ) REFERENCES entities ( id ) ON DELETE CASCADE
+);
+
+-- Soft-deleted content is tombstoned with the deletion time and is hidden from
+-- retrieval and listing until restored or purged.
+ALTER TABLE content_summary ADD COLUMN deleted_at TIMESTAMP NULL DEFAULT NULL;
+CREATE INDEX content_summary_deleted_at_idx ON content_summary ( deleted_at );
+
+-- A content source defines where the content for a namespace is synced from.
+-- The source 'name' is the name of the namespace being synced.
+CREATE TABLE content_sources (
+  id INT(10) UNSIGNED NOT NULL,
+  source_type VARCHAR(16) NOT NULL,
+  name VARCHAR(128) NOT NULL,
+  CONSTRAINT content_sources_key PRIMARY KEY ( id ),
+  CONSTRAINT content_sources_name_unique UNIQUE ( name ),
+  CONSTRAINT content_sources_refs_entities FOREIGN KEY ( id ) REFERENCES entities ( id ) ON DELETE CASCADE
+);
+
+CREATE TABLE content_source_config (
+  source INT(10) UNSIGNED NOT NULL,
+  config_key VARCHAR(64) NOT NULL,
+  config_value TEXT,
+  CONSTRAINT content_source_config_key PRIMARY KEY ( source, config_key ),
+  CONSTRAINT content_source_config_refs_content_sources FOREIGN KEY ( source ) REFERENCES content_sources ( id ) ON DELETE CASCADE
+);
+
+-- Asset ('IMAGE' and 'FILE') content. The bytes are held in the configured
+-- blob store, keyed by the content public ID.
+CREATE TABLE content_type_asset (
+  id INT(10) UNSIGNED NOT NULL,
+  mime_type VARCHAR(255),
+  size BIGINT UNSIGNED,
+  checksum CHAR(64),
+  CONSTRAINT content_type_asset_key PRIMARY KEY ( id ),
+  CONSTRAINT content_type_asset_refs_content FOREIGN KEY ( id ) REFERENCES content_summary ( id ) ON DELETE CASCADE
+);
+
+-- Namespace management. Archived namespaces are retained, but hidden from the
+-- default namespace listing.
+ALTER TABLE namespace
+  ADD COLUMN description TEXT,
+  ADD COLUMN owner INT(10) UNSIGNED NULL DEFAULT NULL,
+  ADD COLUMN archived_at TIMESTAMP NULL DEFAULT NULL,
+  ADD CONSTRAINT namespace_owner_refs_entities FOREIGN KEY ( owner ) REFERENCES entities ( id ) ON DELETE SET NULL;
+
+-- Immutable snapshots of text content taken on every create and update.
+-- 'author' is the authenticated user ID (if any) and 'source' is 'USER' or
+-- 'SYNC'.
+CREATE TABLE content_revisions (
+  content INT(10) UNSIGNED NOT NULL,
+  revision INT(10) UNSIGNED NOT NULL,
+  author VARCHAR(128),
+  source VARCHAR(8) NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  title VARCHAR(255),
+  summary TEXT,
+  slug VARCHAR(255),
+  extern_path VARCHAR(512),
+  version_cookie VARCHAR(255),
+  format VARCHAR(16),
+  text MEDIUMTEXT,
+  CONSTRAINT content_revisions_key PRIMARY KEY ( content, revision ),
+  CONSTRAINT content_revisions_refs_content FOREIGN KEY ( content ) REFERENCES content_summary ( id ) ON DELETE CASCADE
+);
+
+-- One record per content source sync execution. 'trigger_type' is 'MANUAL',
+-- 'SCHEDULED', or 'WEBHOOK'. 'failures' holds the JSON encoded item failures.
+CREATE TABLE content_sync_runs (
+  id INT(10) UNSIGNED NOT NULL AUTO_INCREMENT,
+  source INT(10) UNSIGNED NOT NULL,
+  trigger_type VARCHAR(16) NOT NULL,
+  status VARCHAR(16) NOT NULL,
+  version VARCHAR(255),
+  started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  finished_at TIMESTAMP NULL DEFAULT NULL,
+  created_count INT(10) UNSIGNED NOT NULL DEFAULT 0,
+  updated_count INT(10) UNSIGNED NOT NULL DEFAULT 0,
+  deleted_count INT(10) UNSIGNED NOT NULL DEFAULT 0,
+  failed_count INT(10) UNSIGNED NOT NULL DEFAULT 0,
+  failures MEDIUMTEXT,
+  message TEXT,
+  CONSTRAINT content_sync_runs_key PRIMARY KEY ( id ),
+  INDEX content_sync_runs_source_idx ( source, id ),
+  CONSTRAINT content_sync_runs_refs_content_sources FOREIGN KEY ( source ) REFERENCES content_sources ( id ) ON DELETE CASCADE
+);
+
+-- Per-namespace URL content policy; newline separated host patterns.
+ALTER TABLE namespace
+  ADD COLUMN url_allow_hosts TEXT,
+  ADD COLUMN url_deny_hosts TEXT;
+
+-- Full-text search over content; see ContentGeneralWhereGenerator. The
+-- 'MATCH' column lists must correspond to these indexes.
+CREATE FULLTEXT INDEX content_summary_search_idx ON content_summary ( title, summary );
+CREATE FULLTEXT INDEX content_type_text_search_idx ON content_type_text ( text );
+
+-- Each upload is stored under a new blob key so that concurrent uploads and
+-- failed record updates never leave a record pointing at the wrong bytes. A
+-- null key is a blob stored before keys were introduced, under the content
+-- public ID.
+ALTER TABLE content_type_asset
+  ADD COLUMN blob_key VARCHAR(128);